@@ -1,48 +1,101 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"file-formatter-tools/internal/api"
 	"file-formatter-tools/internal/auth"
 	"file-formatter-tools/internal/config"
 	"file-formatter-tools/internal/jobs"
 	"file-formatter-tools/internal/s3"
+	"file-formatter-tools/internal/schedules"
+	"file-formatter-tools/internal/webhook"
+	"file-formatter-tools/internal/worker"
 
 	// "github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
 )
 
 func main() {
 	// Load config from env
 	cfg := config.Load()
 
+	// Allow `main worker` / `main api` to override MODE
+	if len(os.Args) > 1 {
+		cfg.Mode = os.Args[1]
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Set Gin mode
 	if os.Getenv("GIN_MODE") != "" {
 		gin.SetMode(os.Getenv("GIN_MODE"))
 	}
 
-	// Initialize Redis
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     cfg.RedisAddr,
-		Password: "",
-		DB:       0,
-	})
-	defer rdb.Close()
+	// Initialize the job store
+	store, err := jobs.NewStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize job store: %v", err)
+	}
+	defer store.Close()
+
+	// An in-memory store cannot be shared, so API and workers must run in this process
+	if cfg.JobStore == jobs.StoreMemory && cfg.Mode != "all" {
+		log.Printf("JOB_STORE=memory requires MODE=all, ignoring MODE=%s", cfg.Mode)
+		cfg.Mode = "all"
+	}
 
 	// Initialize S3
 	s3Client := s3.NewS3Client(cfg)
 
 	// Ensure bucket exists
-	err := s3Client.CreateBucketIfNotExists(cfg.S3Bucket)
+	err = s3Client.CreateBucketIfNotExists(cfg.S3Bucket)
 	if err != nil {
 		log.Fatalf("Failed to create S3 bucket: %v", err)
 	}
 
 	// Initialize job manager
-	jobManager := jobs.NewManager(rdb)
+	jobManager := jobs.NewManager(store, cfg)
+
+	// Background processing: job workers, webhook deliveries and recurring schedules
+	pool := worker.NewPool(jobManager, s3Client, cfg)
+	dispatcher := webhook.NewDispatcher(jobManager, cfg)
+	runner := schedules.NewRunner(jobManager, s3Client)
+	var background sync.WaitGroup
+	startBackground := func() {
+		background.Add(3)
+		go func() {
+			defer background.Done()
+			pool.Run(ctx)
+		}()
+		go func() {
+			defer background.Done()
+			dispatcher.Run(ctx)
+		}()
+		go func() {
+			defer background.Done()
+			runner.Run(ctx)
+		}()
+	}
+
+	switch cfg.Mode {
+	case "worker":
+		log.Printf("Running in worker mode")
+		startBackground()
+		background.Wait()
+		return
+	case "api":
+		log.Printf("Running in api mode, jobs are processed by separate workers")
+	default:
+		startBackground()
+	}
 
 	// Gin router
 	r := gin.Default()
@@ -65,7 +118,7 @@ func main() {
 	})
 
 	// API key middleware
-	r.Use(auth.APIKeyAuthMiddleware(cfg.APIKeys))
+	r.Use(auth.APIKeyAuthMiddleware(cfg.APIKeys, cfg.AdminAPIKeys))
 
 	// Register routes with dependencies
 	api.RegisterRoutes(r, jobManager, s3Client, cfg)
@@ -75,6 +128,18 @@ func main() {
 		log.Printf("Registered route: %s %s", route.Method, route.Path)
 	}
 
+	srv := &http.Server{Addr: ":8081", Handler: r}
+	go func() {
+		<-ctx.Done()
+		log.Printf("Shutting down backend ...")
+		_ = srv.Shutdown(context.Background())
+	}()
+
 	log.Printf("Backend listening on :8081 ...")
-	r.Run(":8081")
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Server error: %v", err)
+	}
+
+	// Let in-flight jobs finish before exiting
+	background.Wait()
 }
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"file-formatter-tools/internal/config"
+	"file-formatter-tools/internal/jobs"
+	"file-formatter-tools/internal/s3"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reuseResult completes jobID with the output of an earlier job that had the
+// same input and options, with a fresh download URL. Returns nil on a cache miss.
+func reuseResult(ctx context.Context, jobManager *jobs.Manager, s3Client *s3.Client, cfg *config.Config, jobID, cacheKey string) *jobs.Output {
+	cached, err := jobManager.LookupResult(ctx, cacheKey)
+	if err != nil {
+		log.Printf("[ERROR] [Cache] Failed to look up cached result: %v", err)
+	}
+	if cached == nil {
+		jobManager.CountMetric(ctx, jobs.MetricCacheMisses)
+		return nil
+	}
+
+	url, err := s3Client.GetPresignedURL(ctx, cached.ObjectName, cfg.PresignedURLExpiry)
+	if err != nil {
+		log.Printf("[ERROR] [Cache] Failed to get download URL for cached %s: %v", cached.ObjectName, err)
+		jobManager.CountMetric(ctx, jobs.MetricCacheMisses)
+		return nil
+	}
+	expiresAt := time.Now().Add(cfg.PresignedURLExpiry)
+	output := jobs.Output{
+		ObjectName:  cached.ObjectName,
+		DownloadURL: url,
+		Format:      cached.Format,
+		Width:       cached.Width,
+		Height:      cached.Height,
+		Quality:     cached.Quality,
+		ExpiresAt:   &expiresAt,
+	}
+	if err := jobManager.ReuseResult(ctx, jobID, cacheKey, cached, output); err != nil {
+		log.Printf("[ERROR] [Cache] Failed to reuse result for job %s: %v", jobID, err)
+		jobManager.CountMetric(ctx, jobs.MetricCacheMisses)
+		return nil
+	}
+	jobManager.CountMetric(ctx, jobs.MetricCacheHits)
+	return &output
+}
+
+// Handler: GET /api/metrics
+// Returns the counters shared by every replica, e.g. result cache hits and misses
+func MetricsHandler(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		counters, err := jobManager.Metrics(c.Request.Context())
+		if err != nil {
+			log.Printf("[ERROR] [MetricsHandler] Failed to load metrics: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load metrics", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"counters": counters})
+	}
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"errors"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"file-formatter-tools/internal/auth"
+	"file-formatter-tools/internal/config"
+	"file-formatter-tools/internal/imgproc"
+	"file-formatter-tools/internal/jobs"
+	"file-formatter-tools/internal/s3"
+	"file-formatter-tools/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler: POST /api/center-crop
+// Crops the upload to `width` x `height` (or to an `aspect` such as "16:9" at
+// full resolution) around its most detailed region, or around the focal point
+// `focal_x`, `focal_y` (0-1 from the top-left). The window is chosen here, so
+// the response reports it; cropping and encoding run as a queued job like /api/resize.
+func CenterCropHandler(s3Client *s3.Client, jobManager *jobs.Manager, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		start := time.Now()
+		log.Printf("[INFO] [CenterCropHandler] Incoming request from %s, method=%s, endpoint=%s", c.ClientIP(), c.Request.Method, c.Request.URL.Path)
+
+		if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+			log.Printf("[ERROR] [CenterCropHandler] Failed to parse form: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+			return
+		}
+
+		file, header, err := c.Request.FormFile("image")
+		if err != nil {
+			log.Printf("[ERROR] [CenterCropHandler] Missing image file: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing image file"})
+			return
+		}
+		defer file.Close()
+
+		opts, err := parseResizeOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ratioW, ratioH, err := cropRatio(c, opts)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		focalX, focalY, hasFocus, err := parseFocalPoint(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Interactive single-image requests go ahead of bulk work by default
+		priority := c.DefaultPostForm("priority", jobs.PriorityHigh)
+		if !jobs.ValidPriority(priority) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "priority must be high, normal or low"})
+			return
+		}
+		callbackURL := c.PostForm("callback_url")
+		if callbackURL != "" {
+			if err := webhook.ValidateCallback(cfg, auth.CallerKeyID(c), callbackURL); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		runAt, err := parseRunAt(c, cfg)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		imageData, err := io.ReadAll(file)
+		if err != nil {
+			log.Printf("[ERROR] [CenterCropHandler] Failed to read image: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image"})
+			return
+		}
+		img, format, err := imgproc.Decode(imageData)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported or corrupt image", "details": err.Error()})
+			return
+		}
+		// The window is chosen on the image as the worker will see it
+		if !opts.IgnoreOrientation {
+			img = imgproc.Orient(img, imgproc.ReadMetadata(imageData, format).Orientation)
+		}
+
+		var focus *image.Point
+		if hasFocus {
+			focus = &image.Point{
+				X: int(focalX * float64(img.Bounds().Dx())),
+				Y: int(focalY * float64(img.Bounds().Dy())),
+			}
+		}
+		rect := imgproc.SmartCrop(img, ratioW, ratioH, focus)
+		if opts.Width == 0 || opts.Height == 0 || (opts.ShrinkOnly && rect.Dx() < opts.Width) {
+			// Aspect only, or a crop that may not be enlarged: keep it at full resolution
+			opts.Width, opts.Height = rect.Dx(), rect.Dy()
+		}
+		// The crop already has the target's shape; scale it to the exact size
+		opts.MaintainAspect = false
+		opts.Mode = imgproc.ModeStretch
+		log.Printf("[INFO] [CenterCropHandler] Crop %v of %dx%d, output %dx%d", rect, img.Bounds().Dx(), img.Bounds().Dy(), opts.Width, opts.Height)
+
+		jobID, err := jobManager.NewJob(ctx, jobs.Spec{
+			Type:        "center-crop",
+			KeyID:       auth.CallerKeyID(c),
+			Priority:    priority,
+			Filename:    header.Filename,
+			Options:     &opts,
+			CallbackURL: callbackURL,
+			RunAt:       runAt,
+		})
+		if err != nil {
+			log.Printf("[ERROR] [CenterCropHandler] Failed to create job: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create job"})
+			return
+		}
+
+		inputObject := inputObjectName(jobID, header.Filename)
+		if err := s3Client.Upload(ctx, inputObject, imageData, header.Header.Get("Content-Type")); err != nil {
+			log.Printf("[ERROR] [CenterCropHandler] Failed to store input: %v", err)
+			_ = jobManager.FailJob(ctx, jobID, jobs.ErrCodeStorage, "Failed to store image: "+err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image", "details": err.Error(), "job_id": jobID})
+			return
+		}
+		_ = jobManager.ScheduleDeletion(ctx, inputObject, startTime(runAt).Add(cfg.JobRetention))
+		_ = jobManager.SetProgress(ctx, jobID, 5)
+
+		task := jobs.Task{
+			JobID:       jobID,
+			Type:        "center-crop",
+			KeyID:       auth.CallerKeyID(c),
+			Priority:    priority,
+			InputObject: inputObject,
+			Filename:    header.Filename,
+			Options:     opts,
+			Pipeline: []jobs.Operation{
+				{Type: "crop", Crop: &jobs.CropOptions{X: rect.Min.X, Y: rect.Min.Y, Width: rect.Dx(), Height: rect.Dy()}},
+				{Type: "resize", Options: opts},
+			},
+		}
+		status, err := submit(ctx, jobManager, task, runAt)
+		if err != nil {
+			_ = jobManager.FailJob(ctx, jobID, jobs.ErrCodeInternal, "Could not queue job")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not queue job", "job_id": jobID})
+			return
+		}
+
+		log.Printf("[INFO] [CenterCropHandler] Queued: jobID=%s, status=%s, duration=%s", jobID, status, time.Since(start))
+		resp := gin.H{
+			"job_id": jobID,
+			"status": status,
+			"crop": gin.H{
+				"x":      rect.Min.X,
+				"y":      rect.Min.Y,
+				"width":  rect.Dx(),
+				"height": rect.Dy(),
+			},
+			"width":  opts.Width,
+			"height": opts.Height,
+		}
+		if !runAt.IsZero() {
+			resp["run_at"] = runAt
+		}
+		c.JSON(http.StatusAccepted, resp)
+	}
+}
+
+// cropRatio returns the aspect ratio of the crop: that of width x height, or
+// the `aspect` field when no size is given
+func cropRatio(c *gin.Context, opts jobs.ResizeOptions) (int, int, error) {
+	if opts.Width < 0 || opts.Height < 0 {
+		return 0, 0, errors.New("width and height must be positive")
+	}
+	aspect := c.PostForm("aspect")
+	switch {
+	case opts.Width > 0 && opts.Height > 0:
+		if aspect != "" {
+			return 0, 0, errors.New("give either width and height or aspect, not both")
+		}
+		return opts.Width, opts.Height, nil
+	case opts.Width > 0 || opts.Height > 0:
+		return 0, 0, errors.New("width and height must be given together")
+	case aspect == "":
+		return 0, 0, errors.New("width and height, or aspect, are required")
+	}
+	return jobs.CropOptions{Aspect: aspect}.Ratio()
+}
+
+// parseFocalPoint reads the optional `focal_x` and `focal_y` fields, both between 0 and 1
+func parseFocalPoint(c *gin.Context) (float64, float64, bool, error) {
+	rawX, rawY := c.PostForm("focal_x"), c.PostForm("focal_y")
+	if rawX == "" && rawY == "" {
+		return 0, 0, false, nil
+	}
+	x, errX := strconv.ParseFloat(rawX, 64)
+	y, errY := strconv.ParseFloat(rawY, 64)
+	if errX != nil || errY != nil || x < 0 || x > 1 || y < 0 || y > 1 {
+		return 0, 0, false, errors.New("focal_x and focal_y must both be between 0 and 1")
+	}
+	return x, y, true, nil
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"file-formatter-tools/internal/auth"
+	"file-formatter-tools/internal/jobs"
+	"file-formatter-tools/internal/s3"
+
+	"github.com/gin-gonic/gin"
+)
+
+// downloadURLExpiry is how long the link behind a download redirect is valid;
+// the client follows it right away
+const downloadURLExpiry = 5 * time.Minute
+
+// ActorMiddleware attributes job events recorded while handling a request to
+// the caller's API key ID
+func ActorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(jobs.WithActor(c.Request.Context(), auth.CallerKeyID(c)))
+		c.Next()
+	}
+}
+
+// Handler: /api/jobs/:id/events
+// Returns the history of a job, oldest first. Pass the last event ID as
+// `after` to page through it. The history outlives the job record.
+func JobEventsHandler(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		jobID := c.Param("id")
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit < 1 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+		owner, err := jobManager.Owner(ctx, jobID)
+		if err == nil && !canSee(c, owner) {
+			err = jobs.ErrJobNotFound
+		}
+		if errors.Is(err, jobs.ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load job", "details": err.Error()})
+			return
+		}
+		events, err := jobManager.Events(ctx, jobID, c.Query("after"), int64(limit))
+		if errors.Is(err, jobs.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "after must be an event ID"})
+			return
+		}
+		if err != nil {
+			log.Printf("[ERROR] [JobEventsHandler] Failed to load events for job %s: %v", jobID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load job events", "details": err.Error()})
+			return
+		}
+
+		var next string
+		if len(events) == limit {
+			next = events[len(events)-1].ID
+		}
+		c.JSON(http.StatusOK, gin.H{"job_id": jobID, "events": events, "next_cursor": next})
+	}
+}
+
+// Handler: /api/jobs/:id/download
+// Redirects to an output of a job and records the download in its history.
+// `output` selects a pipeline output by name, or any output by index (default 0).
+// Job outputs link here as tracked_url; fetching download_url directly is not recorded.
+func DownloadHandler(jobManager *jobs.Manager, s3Client *s3.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		jobID := c.Param("id")
+		log.Printf("[INFO] [DownloadHandler] Download request for jobID=%s from %s", jobID, c.ClientIP())
+
+		job, ok := loadJob(c, jobManager, jobID)
+		if !ok {
+			return
+		}
+		if job.RetainUntil != nil && time.Now().After(*job.RetainUntil) {
+			c.JSON(http.StatusGone, gin.H{"error": "Job results have expired", "job_id": jobID})
+			return
+		}
+
+		output := findOutput(job.Outputs, c.DefaultQuery("output", "0"))
+		if output == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Output not found", "job_id": jobID})
+			return
+		}
+		url, err := s3Client.GetPresignedURL(ctx, output.ObjectName, downloadURLExpiry)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get download URL", "details": err.Error()})
+			return
+		}
+
+		details := map[string]interface{}{"object": output.ObjectName, "client_ip": c.ClientIP()}
+		if output.Name != "" {
+			details["name"] = output.Name
+		}
+		jobManager.RecordEvent(ctx, jobID, jobs.EventDownloaded, details)
+		c.Redirect(http.StatusFound, url)
+	}
+}
+
+// findOutput picks an output by name, or else by index
+func findOutput(outputs []jobs.Output, selector string) *jobs.Output {
+	for i := range outputs {
+		if outputs[i].Name != "" && outputs[i].Name == selector {
+			return &outputs[i]
+		}
+	}
+	if i, err := strconv.Atoi(selector); err == nil && i >= 0 && i < len(outputs) {
+		return &outputs[i]
+	}
+	return nil
+}
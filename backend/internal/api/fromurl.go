@@ -0,0 +1,133 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"file-formatter-tools/internal/auth"
+	"file-formatter-tools/internal/config"
+	"file-formatter-tools/internal/fetch"
+	"file-formatter-tools/internal/jobs"
+	"file-formatter-tools/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler: POST /api/upload-from-url
+// Queues one resize job per `url` field (repeat it for several images), with
+// the same options as /api/resize. Workers fetch the images; addresses in
+// private, loopback and link-local ranges are refused unless allow-listed.
+func UploadFromURLHandler(jobManager *jobs.Manager, cfg *config.Config) gin.HandlerFunc {
+	fetcher := fetch.New(cfg)
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		start := time.Now()
+		log.Printf("[INFO] [UploadFromURLHandler] Incoming request from %s, method=%s, endpoint=%s", c.ClientIP(), c.Request.Method, c.Request.URL.Path)
+
+		urls := c.PostFormArray("url")
+		if len(urls) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one url is required"})
+			return
+		}
+		if len(urls) > cfg.FetchMaxURLs {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d urls per request", cfg.FetchMaxURLs)})
+			return
+		}
+		for _, u := range urls {
+			if err := fetcher.CheckURL(u); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid url", "details": err.Error()})
+				return
+			}
+		}
+
+		opts, err := parseResizeOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// A single image is interactive like /api/resize, several are bulk work like /api/batch
+		defaultPriority := jobs.PriorityHigh
+		if len(urls) > 1 {
+			defaultPriority = jobs.PriorityNormal
+		}
+		priority := c.DefaultPostForm("priority", defaultPriority)
+		if !jobs.ValidPriority(priority) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "priority must be high, normal or low"})
+			return
+		}
+		callbackURL := c.PostForm("callback_url")
+		if callbackURL != "" {
+			if err := webhook.ValidateCallback(cfg, auth.CallerKeyID(c), callbackURL); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		runAt, err := parseRunAt(c, cfg)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		urlJobs := []map[string]interface{}{}
+		for _, sourceURL := range urls {
+			filename := urlFilename(sourceURL)
+			jobID, err := jobManager.NewJob(ctx, jobs.Spec{
+				Type:        "resize",
+				KeyID:       auth.CallerKeyID(c),
+				Priority:    priority,
+				Filename:    filename,
+				Options:     &opts,
+				CallbackURL: callbackURL,
+				RunAt:       runAt,
+				SourceURL:   sourceURL,
+			})
+			if err != nil {
+				log.Printf("[ERROR] [UploadFromURLHandler] Could not create job for %s: %v", sourceURL, err)
+				urlJobs = append(urlJobs, map[string]interface{}{"url": sourceURL, "error": "Could not create job"})
+				continue
+			}
+
+			task := jobs.Task{
+				JobID:     jobID,
+				Type:      "resize",
+				KeyID:     auth.CallerKeyID(c),
+				Priority:  priority,
+				Filename:  filename,
+				Options:   opts,
+				SourceURL: sourceURL,
+			}
+			status, err := submit(ctx, jobManager, task, runAt)
+			if err != nil {
+				_ = jobManager.FailJob(ctx, jobID, jobs.ErrCodeInternal, "Could not queue job")
+				urlJobs = append(urlJobs, map[string]interface{}{"url": sourceURL, "job_id": jobID, "error": "Could not queue job"})
+				continue
+			}
+			log.Printf("[INFO] [UploadFromURLHandler] Queued %s as jobID=%s, status=%s", sourceURL, jobID, status)
+			urlJobs = append(urlJobs, map[string]interface{}{"url": sourceURL, "job_id": jobID, "status": status})
+		}
+
+		log.Printf("[INFO] [UploadFromURLHandler] Queued %d urls, duration=%s", len(urls), time.Since(start))
+		resp := gin.H{"jobs": urlJobs}
+		if !runAt.IsZero() {
+			resp["run_at"] = runAt
+		}
+		c.JSON(http.StatusAccepted, resp)
+	}
+}
+
+// urlFilename names a fetched image after the last segment of its URL path
+func urlFilename(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "image"
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return "image"
+	}
+	return name
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+
+	"file-formatter-tools/internal/auth"
+	"file-formatter-tools/internal/config"
+	"file-formatter-tools/internal/jobs"
+
+	"github.com/gin-gonic/gin"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// responseRecorder keeps a copy of the response body for replaying
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware makes a submission safe to retry: a request carrying an
+// Idempotency-Key header runs once, and retries with the same key and payload
+// get the stored response. Reusing a key with a different payload is a 409.
+//
+// A keyed submission is finished even if the client disconnects: the handler
+// runs on a context that is not cancelled with the request, so it never
+// leaves a job half created or a key pending that a retry would then wait out.
+// Requests without the header are cancelled with the client as usual.
+func IdempotencyMiddleware(jobManager *jobs.Manager, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		ctx := context.WithoutCancel(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+		keyID := auth.CallerKeyID(c)
+
+		fingerprint, err := requestFingerprint(c)
+		if err != nil {
+			log.Printf("[ERROR] [Idempotency] Failed to read request: %v", err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+			return
+		}
+
+		existing, err := jobManager.ReserveIdempotencyKey(ctx, keyID, key, fingerprint)
+		if err != nil {
+			log.Printf("[ERROR] [Idempotency] Failed to reserve key: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Could not check Idempotency-Key"})
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Idempotency-Key was already used with a different request"})
+			case existing.Pending:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+			default:
+				log.Printf("[INFO] [Idempotency] Replaying response for key %s", key)
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(existing.StatusCode, "application/json; charset=utf-8", []byte(existing.Body))
+				c.Abort()
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// Server errors are not final; let the client retry them for real
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			_ = jobManager.ReleaseIdempotencyKey(ctx, keyID, key)
+			return
+		}
+		resp := jobs.IdempotentResponse{Fingerprint: fingerprint, StatusCode: status, Body: recorder.body.String()}
+		if err := jobManager.SaveIdempotentResponse(ctx, keyID, key, resp, cfg.IdempotencyTTL); err != nil {
+			log.Printf("[ERROR] [Idempotency] Failed to store response for key %s: %v", key, err)
+		}
+	}
+}
+
+// requestFingerprint hashes the parsed form rather than the raw body, because
+// a retried multipart request usually comes with a new boundary
+func requestFingerprint(c *gin.Context) (string, error) {
+	if err := c.Request.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+		return "", err
+	}
+
+	h := sha256.New()
+	io.WriteString(h, c.Request.Method+" "+c.Request.URL.Path+"\n")
+
+	fields := []string{}
+	for name := range c.Request.PostForm {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	for _, name := range fields {
+		for _, v := range c.Request.PostForm[name] {
+			io.WriteString(h, name+"="+v+"\n")
+		}
+	}
+
+	if form := c.Request.MultipartForm; form != nil {
+		names := []string{}
+		for name := range form.File {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, fh := range form.File[name] {
+				f, err := fh.Open()
+				if err != nil {
+					return "", err
+				}
+				fileHash := sha256.New()
+				_, err = io.Copy(fileHash, f)
+				f.Close()
+				if err != nil {
+					return "", err
+				}
+				io.WriteString(h, name+":"+fh.Filename+":"+hex.EncodeToString(fileHash.Sum(nil))+"\n")
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"file-formatter-tools/internal/auth"
+	"file-formatter-tools/internal/config"
+	"file-formatter-tools/internal/jobs"
+	"file-formatter-tools/internal/s3"
+	"file-formatter-tools/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pipelineRequest is the JSON graph posted in the `pipeline` form field
+type pipelineRequest struct {
+	Steps []jobs.Operation `json:"steps"`
+}
+
+// Handler: POST /api/pipeline
+// Stores the upload and queues a pipeline job that runs a graph of operations
+// (resize, crop, watermark, encode) and uploads each named output
+func PipelineHandler(s3Client *s3.Client, jobManager *jobs.Manager, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		start := time.Now()
+		log.Printf("[INFO] [PipelineHandler] Incoming request from %s, method=%s, endpoint=%s", c.ClientIP(), c.Request.Method, c.Request.URL.Path)
+
+		if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+			log.Printf("[ERROR] [PipelineHandler] Failed to parse form: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+			return
+		}
+
+		var req pipelineRequest
+		if err := json.Unmarshal([]byte(c.PostForm("pipeline")), &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pipeline", "details": err.Error()})
+			return
+		}
+		steps, err := jobs.PlanPipeline(req.Steps)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pipeline", "details": err.Error()})
+			return
+		}
+
+		file, header, err := c.Request.FormFile("image")
+		if err != nil {
+			log.Printf("[ERROR] [PipelineHandler] Missing image file: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing image file"})
+			return
+		}
+		defer file.Close()
+
+		priority := c.DefaultPostForm("priority", jobs.PriorityNormal)
+		if !jobs.ValidPriority(priority) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "priority must be high, normal or low"})
+			return
+		}
+		callbackURL := c.PostForm("callback_url")
+		if callbackURL != "" {
+			if err := webhook.ValidateCallback(cfg, auth.CallerKeyID(c), callbackURL); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		runAt, err := parseRunAt(c, cfg)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		jobID, err := jobManager.NewJob(ctx, jobs.Spec{
+			Type:        "pipeline",
+			KeyID:       auth.CallerKeyID(c),
+			Priority:    priority,
+			Filename:    header.Filename,
+			CallbackURL: callbackURL,
+			RunAt:       runAt,
+		})
+		if err != nil {
+			log.Printf("[ERROR] [PipelineHandler] Failed to create job: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create job"})
+			return
+		}
+		_ = jobManager.SetSteps(ctx, jobID, jobs.PendingSteps(steps))
+		log.Printf("[INFO] [PipelineHandler] Created jobID=%s with %d steps", jobID, len(steps))
+
+		imageData, err := io.ReadAll(file)
+		if err != nil {
+			log.Printf("[ERROR] [PipelineHandler] Failed to read image: %v", err)
+			_ = jobManager.FailJob(ctx, jobID, jobs.ErrCodeInvalidInput, "Failed to read image")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image", "job_id": jobID})
+			return
+		}
+
+		inputObject := inputObjectName(jobID, header.Filename)
+		if err := s3Client.Upload(ctx, inputObject, imageData, header.Header.Get("Content-Type")); err != nil {
+			log.Printf("[ERROR] [PipelineHandler] Failed to store input: %v", err)
+			_ = jobManager.FailJob(ctx, jobID, jobs.ErrCodeStorage, "Failed to store image: "+err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image", "details": err.Error(), "job_id": jobID})
+			return
+		}
+		_ = jobManager.ScheduleDeletion(ctx, inputObject, startTime(runAt).Add(cfg.JobRetention))
+		_ = jobManager.SetProgress(ctx, jobID, 5)
+
+		task := jobs.Task{
+			JobID:       jobID,
+			Type:        "pipeline",
+			KeyID:       auth.CallerKeyID(c),
+			Priority:    priority,
+			InputObject: inputObject,
+			Filename:    header.Filename,
+			Pipeline:    steps,
+		}
+		status, err := submit(ctx, jobManager, task, runAt)
+		if err != nil {
+			_ = jobManager.FailJob(ctx, jobID, jobs.ErrCodeInternal, "Could not queue job")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not queue job", "job_id": jobID})
+			return
+		}
+
+		log.Printf("[INFO] [PipelineHandler] Queued: jobID=%s, status=%s, duration=%s", jobID, status, time.Since(start))
+		resp := gin.H{
+			"job_id": jobID,
+			"status": status,
+			"steps":  jobs.PendingSteps(steps),
+		}
+		if !runAt.IsZero() {
+			resp["run_at"] = runAt
+		}
+		c.JSON(http.StatusAccepted, resp)
+	}
+}
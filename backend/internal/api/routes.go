@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,146 +12,222 @@ import (
 	"strings"
 	"time"
 
+	"file-formatter-tools/internal/auth"
 	"file-formatter-tools/internal/config"
 	"file-formatter-tools/internal/imgproc"
 	"file-formatter-tools/internal/jobs"
 	"file-formatter-tools/internal/s3"
+	"file-formatter-tools/internal/webhook"
 
 	"github.com/gin-gonic/gin"
 )
 
 func RegisterRoutes(r *gin.Engine, jobManager *jobs.Manager, s3Client *s3.Client, cfg *config.Config) {
 	api := r.Group("/api")
+	api.Use(ActorMiddleware())
 	{
 		api.GET("/progress/:jobID", ProgressHandler(jobManager))
-		api.POST("/resize", ResizeHandler(s3Client, jobManager))
-		api.POST("/batch", BatchHandler(s3Client, jobManager))
-		api.POST("/center-crop", CenterCropHandler())
-		api.POST("/upload-from-url", UploadFromURLHandler())
+		api.GET("/progress/:jobID/stream", ProgressStreamHandler(jobManager))
+		api.GET("/progress/:jobID/ws", ProgressWebSocketHandler(jobManager))
+		api.GET("/jobs", ListJobsHandler(jobManager))
+		api.GET("/jobs/:id", JobHandler(jobManager))
+		api.GET("/jobs/:id/children", ChildrenHandler(jobManager))
+		api.DELETE("/jobs/:id", CancelJobHandler(jobManager))
+		api.POST("/jobs/:id/extend", ExtendJobHandler(jobManager, s3Client, cfg))
+		api.GET("/jobs/:id/webhooks", WebhookLogHandler(jobManager))
+		api.GET("/jobs/:id/events", JobEventsHandler(jobManager))
+		api.GET("/jobs/:id/download", DownloadHandler(jobManager, s3Client))
+		api.GET("/dead-letters", DeadLettersHandler(jobManager))
+		api.GET("/metrics", MetricsHandler(jobManager))
+		api.GET("/schedules", ListSchedulesHandler(jobManager))
+		api.POST("/schedules", CreateScheduleHandler(jobManager))
+		api.GET("/schedules/:id", ScheduleHandler(jobManager))
+		api.PUT("/schedules/:id", UpdateScheduleHandler(jobManager))
+		api.DELETE("/schedules/:id", DeleteScheduleHandler(jobManager))
+		api.GET("/schedules/:id/runs", ScheduleRunsHandler(jobManager))
+		api.POST("/resize", IdempotencyMiddleware(jobManager, cfg), ResizeHandler(s3Client, jobManager, cfg))
+		api.POST("/batch", IdempotencyMiddleware(jobManager, cfg), BatchHandler(s3Client, jobManager, cfg))
+		api.POST("/pipeline", IdempotencyMiddleware(jobManager, cfg), PipelineHandler(s3Client, jobManager, cfg))
+		api.POST("/center-crop", IdempotencyMiddleware(jobManager, cfg), CenterCropHandler(s3Client, jobManager, cfg))
+		api.POST("/upload-from-url", IdempotencyMiddleware(jobManager, cfg), UploadFromURLHandler(jobManager, cfg))
 	}
 }
 
-// Placeholder handler: /api/resize
-func ResizeHandler(s3Client *s3.Client, jobManager *jobs.Manager) gin.HandlerFunc {
+// Handler: /api/resize
+// Stores the upload and queues a resize job; the result is reported by /api/progress/:jobID
+func ResizeHandler(s3Client *s3.Client, jobManager *jobs.Manager, cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 		start := time.Now()
 		log.Printf("[INFO] [ResizeHandler] Incoming request from %s, method=%s, endpoint=%s", c.ClientIP(), c.Request.Method, c.Request.URL.Path)
 
-		// 1. Create job ID and set initial progress
-		jobID, err := jobManager.NewJob(ctx)
-		if err != nil {
-			log.Printf("[ERROR] [ResizeHandler] Failed to create job: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create job"})
-			return
-		}
-		_ = jobManager.SetProgress(ctx, jobID, 5)
-		log.Printf("[INFO] [ResizeHandler] Created jobID=%s", jobID)
-
-		// ... (the rest of your image processing code)
-		// For each major step below, update the progress:
-		// e.g., jobManager.SetProgress(ctx, jobID, 20)
-
 		// Parse form (max 32MB)
 		if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
 			log.Printf("[ERROR] [ResizeHandler] Failed to parse form: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form", "job_id": jobID})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
 			return
 		}
-		_ = jobManager.SetProgress(ctx, jobID, 10)
 
 		// Get file
 		file, header, err := c.Request.FormFile("image")
 		if err != nil {
 			log.Printf("[ERROR] [ResizeHandler] Missing image file: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing image file", "job_id": jobID})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing image file"})
 			return
 		}
 		defer file.Close()
 		log.Printf("[INFO] [ResizeHandler] Received file: %s", header.Filename)
-		_ = jobManager.SetProgress(ctx, jobID, 20)
 
-		// Read options
-		width, _ := strconv.Atoi(c.PostForm("width"))
-		height, _ := strconv.Atoi(c.PostForm("height"))
-		maintainAspect := c.PostForm("maintainAspectRatio") == "true"
-		quality, _ := strconv.Atoi(c.DefaultPostForm("quality", "85"))
-		maxSizeKB, _ := strconv.Atoi(c.DefaultPostForm("max_size_kb", "0")) // 0 = no limit
+		// Interactive single-image requests go ahead of bulk work by default
+		priority := c.DefaultPostForm("priority", jobs.PriorityHigh)
+		if !jobs.ValidPriority(priority) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "priority must be high, normal or low"})
+			return
+		}
 
-		log.Printf("[INFO] [ResizeHandler] Options: width=%d, height=%d, maintainAspect=%t, quality=%d, maxSizeKB=%d", width, height, maintainAspect, quality, maxSizeKB)
+		// Optional webhook
+		callbackURL := c.PostForm("callback_url")
+		if callbackURL != "" {
+			if err := webhook.ValidateCallback(cfg, auth.CallerKeyID(c), callbackURL); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
 
-		// Detect extension/format
-		ext := strings.ToLower(filepath.Ext(header.Filename))
-		if ext == "" {
-			ext = ".jpg" // default
+		// Optional start time
+		runAt, err := parseRunAt(c, cfg)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 
+		// Read options
+		opts, err := parseResizeOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("[INFO] [ResizeHandler] Options: width=%d, height=%d, maintainAspect=%t, quality=%d, maxSizeKB=%d, outputFormat=%s, autoOrient=%t, metadata=%s, mode=%s, filter=%s", opts.Width, opts.Height, opts.MaintainAspect, opts.Quality, opts.MaxSizeKB, opts.OutputFormat, !opts.IgnoreOrientation, opts.Metadata, opts.Mode, opts.Filter)
+
+		// Create the job record
+		jobID, err := jobManager.NewJob(ctx, jobs.Spec{
+			Type:        "resize",
+			KeyID:       auth.CallerKeyID(c),
+			Priority:    priority,
+			Filename:    header.Filename,
+			Options:     &opts,
+			CallbackURL: callbackURL,
+			RunAt:       runAt,
+		})
+		if err != nil {
+			log.Printf("[ERROR] [ResizeHandler] Failed to create job: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create job"})
+			return
+		}
+		log.Printf("[INFO] [ResizeHandler] Created jobID=%s", jobID)
+
 		// Read file into buffer
 		imageData, err := io.ReadAll(file)
 		if err != nil {
 			log.Printf("[ERROR] [ResizeHandler] Failed to read image: %v", err)
+			_ = jobManager.FailJob(ctx, jobID, jobs.ErrCodeInvalidInput, "Failed to read image")
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image", "job_id": jobID})
 			return
 		}
-		_ = jobManager.SetProgress(ctx, jobID, 30)
 
-		// Do the resize
-		result, format, err := imgproc.ResizeImage(imageData, width, height, maintainAspect, quality, maxSizeKB)
-		if err != nil {
-			log.Printf("[ERROR] [ResizeHandler] Image resize failed: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Image resize failed", "details": err.Error(), "job_id": jobID})
-			return
+		// Same image and options as an earlier job: hand out its result instead of processing again
+		cacheKey := ""
+		if cfg.ResultCache && runAt.IsZero() {
+			cacheKey = jobs.CacheKey(auth.CallerKeyID(c), imageData, opts)
+			if output := reuseResult(ctx, jobManager, s3Client, cfg, jobID, cacheKey); output != nil {
+				log.Printf("[INFO] [ResizeHandler] Cache hit: jobID=%s, duration=%s", jobID, time.Since(start))
+				c.JSON(http.StatusOK, gin.H{
+					"job_id":  jobID,
+					"status":  jobs.StatusSucceeded,
+					"cached":  true,
+					"outputs": []jobs.Output{*output},
+				})
+				return
+			}
 		}
-		_ = jobManager.SetProgress(ctx, jobID, 60)
-		log.Printf("[INFO] [ResizeHandler] Resized image to format=%s", format)
-
-		// Generate object name (unique)
-		uid := fmt.Sprintf("%d", time.Now().UnixNano())
-		ext = strings.TrimPrefix(ext, ".")
-		objectName := fmt.Sprintf("resize/%s.%s", uid, ext)
-		contentType := "image/" + format
 
-		// Upload to S3
-		log.Printf("[INFO] [ResizeHandler] Uploading file to S3: %s", objectName)
-		if err := s3Client.Upload(ctx, objectName, result, contentType); err != nil {
-			log.Printf("[ERROR] [ResizeHandler] Failed to upload to S3: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload to S3", "details": err.Error(), "job_id": jobID})
+		// Persist the input so any worker can pick it up
+		inputObject := inputObjectName(jobID, header.Filename)
+		if err := s3Client.Upload(ctx, inputObject, imageData, header.Header.Get("Content-Type")); err != nil {
+			log.Printf("[ERROR] [ResizeHandler] Failed to store input: %v", err)
+			_ = jobManager.FailJob(ctx, jobID, jobs.ErrCodeStorage, "Failed to store image: "+err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image", "details": err.Error(), "job_id": jobID})
 			return
 		}
-		_ = jobManager.SetProgress(ctx, jobID, 80)
+		_ = jobManager.ScheduleDeletion(ctx, inputObject, startTime(runAt).Add(cfg.JobRetention))
+		_ = jobManager.SetProgress(ctx, jobID, 5)
 
-		// Get presigned URL
-		url, err := s3Client.GetPresignedURL(ctx, objectName, 10*time.Hour)
+		task := jobs.Task{
+			JobID:       jobID,
+			Type:        "resize",
+			KeyID:       auth.CallerKeyID(c),
+			Priority:    priority,
+			InputObject: inputObject,
+			Filename:    header.Filename,
+			Options:     opts,
+			CacheKey:    cacheKey,
+		}
+		status, err := submit(ctx, jobManager, task, runAt)
 		if err != nil {
-			log.Printf("[ERROR] [ResizeHandler] Failed to get download URL: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get download URL", "details": err.Error(), "job_id": jobID})
+			_ = jobManager.FailJob(ctx, jobID, jobs.ErrCodeInternal, "Could not queue job")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not queue job", "job_id": jobID})
 			return
 		}
-		_ = jobManager.CompleteJob(ctx, jobID)
 
-		// Respond with download link and job ID
-		log.Printf("[INFO] [ResizeHandler] Success: jobID=%s, download_url=%s, duration=%s", jobID, url, time.Since(start))
-		c.JSON(http.StatusOK, gin.H{
-			"job_id":       jobID,
-			"download_url": url,
-			"format":       format,
-			"object_name":  objectName,
-		})
+		log.Printf("[INFO] [ResizeHandler] Queued: jobID=%s, status=%s, duration=%s", jobID, status, time.Since(start))
+		resp := gin.H{
+			"job_id": jobID,
+			"status": status,
+			"cached": false,
+		}
+		if !runAt.IsZero() {
+			resp["run_at"] = runAt
+		}
+		c.JSON(http.StatusAccepted, resp)
 	}
 }
 
-func BatchHandler(s3Client *s3.Client, jobManager *jobs.Manager) gin.HandlerFunc {
+// Handler: /api/batch
+// Stores every upload and queues one resize job per image under a parent batch job
+func BatchHandler(s3Client *s3.Client, jobManager *jobs.Manager, cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 		start := time.Now()
 		log.Printf("[INFO] [BatchHandler] Incoming request from %s, method=%s, endpoint=%s", c.ClientIP(), c.Request.Method, c.Request.URL.Path)
 
 		// Read options
-		width, _ := strconv.Atoi(c.PostForm("width"))
-		height, _ := strconv.Atoi(c.PostForm("height"))
-		maintainAspect := c.PostForm("maintainAspectRatio") == "true"
-		quality, _ := strconv.Atoi(c.DefaultPostForm("quality", "85"))
-		maxSizeKB, _ := strconv.Atoi(c.DefaultPostForm("max_size_kb", "0")) // 0 = no limit
+		opts, err := parseResizeOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		priority := c.DefaultPostForm("priority", jobs.PriorityNormal)
+		if !jobs.ValidPriority(priority) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "priority must be high, normal or low"})
+			return
+		}
+
+		// Optional webhook, sent once for the whole batch
+		callbackURL := c.PostForm("callback_url")
+		if callbackURL != "" {
+			if err := webhook.ValidateCallback(cfg, auth.CallerKeyID(c), callbackURL); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		// Optional start time, shared by every image
+		runAt, err := parseRunAt(c, cfg)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
 		// Parse files
 		form, err := c.MultipartForm()
@@ -167,21 +245,41 @@ func BatchHandler(s3Client *s3.Client, jobManager *jobs.Manager) gin.HandlerFunc
 		log.Printf("[INFO] [BatchHandler] Number of images: %d", len(imageFiles))
 
 		// Create parent batch job
-		batchJobID, err := jobManager.NewJob(ctx)
+		batchJobID, err := jobManager.NewJob(ctx, jobs.Spec{Type: "batch", KeyID: auth.CallerKeyID(c), Priority: priority, Options: &opts, CallbackURL: callbackURL, RunAt: runAt})
 		if err != nil {
 			log.Printf("[ERROR] [BatchHandler] Could not create batch job: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create batch job"})
 			return
 		}
-		_ = jobManager.SetProgress(ctx, batchJobID, 0)
-		numFiles := len(imageFiles)
+		if err := jobManager.SetBatchSize(ctx, batchJobID, len(imageFiles)); err != nil {
+			log.Printf("[ERROR] [BatchHandler] Could not initialise batch job: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create batch job"})
+			return
+		}
 
 		imageJobs := []map[string]interface{}{}
-		for idx, fileHeader := range imageFiles {
+		created := 0
+		for _, fileHeader := range imageFiles {
 			// Create sub-job for image
-			jobID, _ := jobManager.NewJob(ctx)
-			_ = jobManager.SetProgress(ctx, jobID, 5)
-			log.Printf("[INFO] [BatchHandler] Processing file %s, jobID=%s", fileHeader.Filename, jobID)
+			jobID, err := jobManager.NewJob(ctx, jobs.Spec{
+				Type:     "resize",
+				ParentID: batchJobID,
+				KeyID:    auth.CallerKeyID(c),
+				Priority: priority,
+				Filename: fileHeader.Filename,
+				Options:  &opts,
+				RunAt:    runAt,
+			})
+			if err != nil {
+				log.Printf("[ERROR] [BatchHandler] Could not create job for %s: %v", fileHeader.Filename, err)
+				imageJobs = append(imageJobs, map[string]interface{}{
+					"filename": fileHeader.Filename,
+					"error":    "Could not create job",
+				})
+				continue
+			}
+			created++
+			log.Printf("[INFO] [BatchHandler] Queueing file %s, jobID=%s", fileHeader.Filename, jobID)
 
 			// Open file
 			file, err := fileHeader.Open()
@@ -192,6 +290,7 @@ func BatchHandler(s3Client *s3.Client, jobManager *jobs.Manager) gin.HandlerFunc
 					"filename": fileHeader.Filename,
 					"error":    "Failed to open image",
 				})
+				_ = jobManager.FailJob(ctx, jobID, jobs.ErrCodeInvalidInput, "Failed to open image")
 				continue
 			}
 			imageData, err := io.ReadAll(file)
@@ -203,108 +302,194 @@ func BatchHandler(s3Client *s3.Client, jobManager *jobs.Manager) gin.HandlerFunc
 					"filename": fileHeader.Filename,
 					"error":    "Failed to read image",
 				})
+				_ = jobManager.FailJob(ctx, jobID, jobs.ErrCodeInvalidInput, "Failed to read image")
 				continue
 			}
-			_ = jobManager.SetProgress(ctx, jobID, 20)
 
-			// Detect extension/format
-			ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
-			if ext == "" {
-				ext = ".jpg" // default
+			cacheKey := ""
+			if cfg.ResultCache && runAt.IsZero() {
+				cacheKey = jobs.CacheKey(auth.CallerKeyID(c), imageData, opts)
+				if output := reuseResult(ctx, jobManager, s3Client, cfg, jobID, cacheKey); output != nil {
+					imageJobs = append(imageJobs, map[string]interface{}{
+						"job_id":   jobID,
+						"filename": fileHeader.Filename,
+						"status":   jobs.StatusSucceeded,
+						"cached":   true,
+						"outputs":  []jobs.Output{*output},
+					})
+					continue
+				}
 			}
 
-			// Resize
-			result, format, err := imgproc.ResizeImage(imageData, width, height, maintainAspect, quality, maxSizeKB)
-			if err != nil {
-				log.Printf("[ERROR] [BatchHandler] Resize failed for file %s: %v", fileHeader.Filename, err)
+			// Persist the input so any worker can pick it up
+			inputObject := inputObjectName(jobID, fileHeader.Filename)
+			if err := s3Client.Upload(ctx, inputObject, imageData, fileHeader.Header.Get("Content-Type")); err != nil {
+				log.Printf("[ERROR] [BatchHandler] Failed to store input: %v", err)
 				imageJobs = append(imageJobs, map[string]interface{}{
 					"job_id":   jobID,
 					"filename": fileHeader.Filename,
-					"error":    "Resize failed: " + err.Error(),
+					"error":    "Failed to store image: " + err.Error(),
 				})
-				_ = jobManager.CompleteJob(ctx, jobID)
+				_ = jobManager.FailJob(ctx, jobID, jobs.ErrCodeStorage, "Failed to store image: "+err.Error())
 				continue
 			}
-			_ = jobManager.SetProgress(ctx, jobID, 60)
-
-			// Upload to S3
-			uid := fmt.Sprintf("%d", time.Now().UnixNano())
-			ext = strings.TrimPrefix(ext, ".")
-			objectName := fmt.Sprintf("batch/%s_%s.%s", jobID, uid, ext)
-			contentType := "image/" + format
+			_ = jobManager.ScheduleDeletion(ctx, inputObject, startTime(runAt).Add(cfg.JobRetention))
+			_ = jobManager.SetProgress(ctx, jobID, 5)
 
-			log.Printf("[INFO] [BatchHandler] Uploading file to S3: %s", objectName)
-			if err := s3Client.Upload(ctx, objectName, result, contentType); err != nil {
-				log.Printf("[ERROR] [BatchHandler] Failed to upload to S3: %v", err)
-				imageJobs = append(imageJobs, map[string]interface{}{
-					"job_id":   jobID,
-					"filename": fileHeader.Filename,
-					"error":    "Failed to upload to S3: " + err.Error(),
-				})
-				_ = jobManager.CompleteJob(ctx, jobID)
-				continue
+			task := jobs.Task{
+				JobID:       jobID,
+				BatchID:     batchJobID,
+				Type:        "resize",
+				KeyID:       auth.CallerKeyID(c),
+				Priority:    priority,
+				InputObject: inputObject,
+				Filename:    fileHeader.Filename,
+				Options:     opts,
+				CacheKey:    cacheKey,
 			}
-			_ = jobManager.SetProgress(ctx, jobID, 80)
-
-			// Presigned URL
-			url, err := s3Client.GetPresignedURL(ctx, objectName, 10*time.Minute)
+			status, err := submit(ctx, jobManager, task, runAt)
 			if err != nil {
-				log.Printf("[ERROR] [BatchHandler] Failed to get download URL: %v", err)
 				imageJobs = append(imageJobs, map[string]interface{}{
 					"job_id":   jobID,
 					"filename": fileHeader.Filename,
-					"error":    "Failed to get download URL: " + err.Error(),
+					"error":    "Could not queue job",
 				})
-				_ = jobManager.CompleteJob(ctx, jobID)
+				_ = jobManager.FailJob(ctx, jobID, jobs.ErrCodeInternal, "Could not queue job")
 				continue
 			}
 
-			_ = jobManager.CompleteJob(ctx, jobID)
-
 			imageJobs = append(imageJobs, map[string]interface{}{
-				"job_id":       jobID,
-				"filename":     fileHeader.Filename,
-				"download_url": url,
-				"format":       format,
-				"object_name":  objectName,
+				"job_id":   jobID,
+				"filename": fileHeader.Filename,
+				"status":   status,
+				"cached":   false,
 			})
+		}
 
-			// Update batch job progress
-			log.Printf("[INFO] [BatchHandler] Completed file %s, jobID=%s", fileHeader.Filename, jobID)
-			_ = jobManager.SetProgress(ctx, batchJobID, (idx+1)*100/numFiles)
+		// Children that could not be created will never finish, so don't wait for them
+		if created < len(imageFiles) {
+			_ = jobManager.SetBatchSize(ctx, batchJobID, created)
 		}
+		_ = jobManager.RefreshBatch(ctx, batchJobID)
 
-		_ = jobManager.CompleteJob(ctx, batchJobID)
-		log.Printf("[INFO] [BatchHandler] Batch completed: batchJobID=%s, duration=%s", batchJobID, time.Since(start))
+		log.Printf("[INFO] [BatchHandler] Batch queued: batchJobID=%s, duration=%s", batchJobID, time.Since(start))
 
-		c.JSON(http.StatusOK, gin.H{
+		resp := gin.H{
 			"message":      "Batch resize is experimental.",
 			"batch_job_id": batchJobID,
 			"image_jobs":   imageJobs,
-		})
+		}
+		if !runAt.IsZero() {
+			resp["run_at"] = runAt
+		}
+		c.JSON(http.StatusAccepted, resp)
 	}
 }
 
-// Placeholder handler: /api/center-crop
-func CenterCropHandler() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		log.Printf("[INFO] [CenterCropHandler] Not implemented endpoint called from %s", c.ClientIP())
-		c.JSON(http.StatusOK, gin.H{
-			"message":  "Center-crop endpoint hit",
-			"endpoint": "/api/center-crop",
-		})
+// parseResizeOptions reads the resize form fields shared by /api/resize and /api/batch
+func parseResizeOptions(c *gin.Context) (jobs.ResizeOptions, error) {
+	width, _ := strconv.Atoi(c.PostForm("width"))
+	height, _ := strconv.Atoi(c.PostForm("height"))
+	quality, _ := strconv.Atoi(c.DefaultPostForm("quality", "85"))
+	maxSizeKB, _ := strconv.Atoi(c.DefaultPostForm("max_size_kb", "0")) // 0 = no limit
+	outputFormat, err := imgproc.NormalizeFormat(c.PostForm("output_format"))
+	if err != nil {
+		return jobs.ResizeOptions{}, err
+	}
+	// Photos are turned upright unless auto_orient=false
+	autoOrient, err := strconv.ParseBool(c.DefaultPostForm("auto_orient", "true"))
+	if err != nil {
+		return jobs.ResizeOptions{}, errors.New("auto_orient must be true or false")
+	}
+	metadata, err := imgproc.NormalizeMetadataPolicy(c.PostForm("metadata"))
+	if err != nil {
+		return jobs.ResizeOptions{}, err
+	}
+	shrinkOnly, err := strconv.ParseBool(c.DefaultPostForm("shrink_only", "false"))
+	if err != nil {
+		return jobs.ResizeOptions{}, errors.New("shrink_only must be true or false")
+	}
+	opts := jobs.ResizeOptions{
+		Width:             width,
+		Height:            height,
+		MaintainAspect:    c.PostForm("maintainAspectRatio") == "true",
+		Quality:           quality,
+		MaxSizeKB:         maxSizeKB,
+		OutputFormat:      outputFormat,
+		IgnoreOrientation: !autoOrient,
+		Metadata:          metadata,
+		Anchor:            strings.ToLower(c.PostForm("anchor")),
+		Background:        c.PostForm("background"),
+		Filter:            strings.ToLower(c.PostForm("filter")),
+		ShrinkOnly:        shrinkOnly,
+	}
+	// Without a mode, maintainAspectRatio picks fit or fill as before
+	opts.Mode = opts.Spec().Mode
+	if mode := strings.ToLower(c.PostForm("mode")); mode != "" {
+		opts.Mode = mode
 	}
+	if err := opts.Spec().Validate(); err != nil {
+		return jobs.ResizeOptions{}, err
+	}
+	return opts, nil
 }
 
-// Placeholder handler: /api/upload-from-url
-func UploadFromURLHandler() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		log.Printf("[INFO] [UploadFromURLHandler] Not implemented endpoint called from %s", c.ClientIP())
-		c.JSON(http.StatusOK, gin.H{
-			"message":  "Upload-from-url endpoint hit",
-			"endpoint": "/api/upload-from-url",
-		})
+// parseRunAt reads the optional start time of a job: either `run_at` (RFC 3339)
+// or `delay` (e.g. "8h"). Returns the zero time when the job should run now.
+func parseRunAt(c *gin.Context, cfg *config.Config) (time.Time, error) {
+	rawRunAt, rawDelay := c.PostForm("run_at"), c.PostForm("delay")
+	var runAt time.Time
+	switch {
+	case rawRunAt != "" && rawDelay != "":
+		return time.Time{}, errors.New("use either run_at or delay, not both")
+	case rawRunAt != "":
+		t, err := time.Parse(time.RFC3339, rawRunAt)
+		if err != nil {
+			return time.Time{}, errors.New("run_at must be an RFC 3339 timestamp")
+		}
+		runAt = t
+	case rawDelay != "":
+		d, err := time.ParseDuration(rawDelay)
+		if err != nil || d < 0 {
+			return time.Time{}, errors.New("delay must be a positive duration such as 30m or 8h")
+		}
+		runAt = time.Now().Add(d)
+	default:
+		return time.Time{}, nil
+	}
+	if time.Until(runAt) > cfg.MaxScheduleDelay {
+		return time.Time{}, fmt.Errorf("jobs can be scheduled at most %s ahead", cfg.MaxScheduleDelay)
 	}
+	if !runAt.After(time.Now()) {
+		return time.Time{}, nil // already due
+	}
+	return runAt.UTC(), nil
+}
+
+// startTime is when a job submitted with runAt starts waiting for a worker
+func startTime(runAt time.Time) time.Time {
+	if runAt.IsZero() {
+		return time.Now()
+	}
+	return runAt
+}
+
+// submit queues a task now, or puts it on the delay queue when runAt is set,
+// and returns the resulting job status
+func submit(ctx context.Context, jobManager *jobs.Manager, task jobs.Task, runAt time.Time) (jobs.Status, error) {
+	if runAt.IsZero() {
+		return jobs.StatusQueued, jobManager.Enqueue(ctx, task)
+	}
+	return jobs.StatusScheduled, jobManager.ScheduleJob(ctx, task, runAt)
+}
+
+// inputObjectName is where an uploaded original is kept until a worker processes it
+func inputObjectName(jobID, filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == "" {
+		ext = ".jpg" // default
+	}
+	return fmt.Sprintf("uploads/%s%s", jobID, ext)
 }
 
 // Handler: /api/progress/:jobID
@@ -312,12 +497,266 @@ func ProgressHandler(jobManager *jobs.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		jobID := c.Param("jobID")
 		log.Printf("[INFO] [ProgressHandler] Progress request for jobID=%s from %s", jobID, c.ClientIP())
-		progress, err := jobManager.GetProgress(jobID)
+		respondWithJob(c, jobManager, jobID)
+	}
+}
+
+// Handler: /api/jobs/:id
+func JobHandler(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID := c.Param("id")
+		log.Printf("[INFO] [JobHandler] Job request for jobID=%s from %s", jobID, c.ClientIP())
+		respondWithJob(c, jobManager, jobID)
+	}
+}
+
+// Handler: /api/jobs
+// Lists the caller's jobs filtered by status, type and creation time, with cursor pagination.
+// Admin keys see every API key's jobs and may filter by key_id.
+// status=scheduled lists jobs waiting for their run_at; DELETE /api/jobs/:id cancels them.
+func ListJobsHandler(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log.Printf("[INFO] [ListJobsHandler] List request from %s: %s", c.ClientIP(), c.Request.URL.RawQuery)
+
+		filter := jobs.Filter{
+			Status: jobs.Status(c.Query("status")),
+			Type:   c.Query("type"),
+			KeyID:  auth.CallerKeyID(c),
+			Cursor: c.Query("cursor"),
+		}
+		if auth.IsAdmin(c) {
+			filter.KeyID = c.Query("key_id")
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 || limit > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+			return
+		}
+		filter.Limit = limit
+
+		switch c.DefaultQuery("order", "desc") {
+		case "asc":
+			filter.Ascending = true
+		case "desc":
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "order must be asc or desc"})
+			return
+		}
+
+		for param, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+			if raw := c.Query(param); raw != "" {
+				t, err := time.Parse(time.RFC3339, raw)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC 3339 timestamp"})
+					return
+				}
+				*dst = t
+			}
+		}
+
+		list, next, err := jobManager.List(c.Request.Context(), filter)
+		if err != nil {
+			log.Printf("[ERROR] [ListJobsHandler] Failed to list jobs: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list jobs", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"jobs": list, "next_cursor": next})
+	}
+}
+
+// Handler: /api/jobs/:id/children
+// Lists the per-image jobs of a batch with their status, error and download URL
+func ChildrenHandler(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		batchID := c.Param("id")
+		log.Printf("[INFO] [ChildrenHandler] Children request for batchJobID=%s from %s", batchID, c.ClientIP())
+
+		batch, ok := loadJob(c, jobManager, batchID)
+		if !ok {
+			return
+		}
+
+		children, err := jobManager.Children(ctx, batchID)
 		if err != nil {
-			log.Printf("[ERROR] [ProgressHandler] Job not found: jobID=%s", jobID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load child jobs", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"batch_job_id": batchID,
+			"status":       batch.Status,
+			"progress":     batch.Progress,
+			"children":     children,
+		})
+	}
+}
+
+// Handler: DELETE /api/jobs/:id
+// Cancels a scheduled, queued or running job; for a batch the remaining images are skipped
+func CancelJobHandler(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID := c.Param("id")
+		log.Printf("[INFO] [CancelJobHandler] Cancel request for jobID=%s from %s", jobID, c.ClientIP())
+		if _, ok := loadJob(c, jobManager, jobID); !ok {
+			return
+		}
+
+		err := jobManager.Cancel(c.Request.Context(), jobID)
+		switch {
+		case errors.Is(err, jobs.ErrJobNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+			return
+		case errors.Is(err, jobs.ErrJobFinished):
+			c.JSON(http.StatusConflict, gin.H{"error": "Job already finished", "job_id": jobID})
+			return
+		case err != nil:
+			log.Printf("[ERROR] [CancelJobHandler] Failed to cancel job %s: %v", jobID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not cancel job", "details": err.Error()})
+			return
+		}
+		respondWithJob(c, jobManager, jobID)
+	}
+}
+
+// Handler: POST /api/jobs/:id/extend
+// Keeps a job and its results for `duration` (e.g. "24h") from now and re-issues download URLs
+func ExtendJobHandler(jobManager *jobs.Manager, s3Client *s3.Client, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		jobID := c.Param("id")
+		log.Printf("[INFO] [ExtendJobHandler] Extend request for jobID=%s from %s", jobID, c.ClientIP())
+
+		d, err := time.ParseDuration(c.PostForm("duration"))
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "duration must be a positive duration such as 24h"})
+			return
+		}
+		if _, ok := loadJob(c, jobManager, jobID); !ok {
+			return
+		}
+
+		until, err := jobManager.Extend(ctx, jobID, d)
+		if errors.Is(err, jobs.ErrJobNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"job_id": jobID, "progress": progress})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not extend job", "details": err.Error()})
+			return
+		}
+
+		// Re-issue download links so they stay valid for the new retention
+		job, err := jobManager.GetJob(ctx, jobID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load job", "details": err.Error()})
+			return
+		}
+		children, err := jobManager.Children(ctx, jobID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load child jobs", "details": err.Error()})
+			return
+		}
+		for _, j := range append([]*jobs.Job{job}, children...) {
+			if len(j.Outputs) == 0 || j.RetainUntil == nil {
+				continue
+			}
+			expiry := cfg.URLExpiry(*j.RetainUntil)
+			expiresAt := time.Now().Add(expiry)
+			for i := range j.Outputs {
+				url, err := s3Client.GetPresignedURL(ctx, j.Outputs[i].ObjectName, expiry)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get download URL", "details": err.Error()})
+					return
+				}
+				j.Outputs[i].DownloadURL = url
+				j.Outputs[i].ExpiresAt = &expiresAt
+			}
+			if err := jobManager.SetOutputs(ctx, j.ID, j.Outputs); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update job", "details": err.Error()})
+				return
+			}
+		}
+
+		log.Printf("[INFO] [ExtendJobHandler] Job %s retained until %s", jobID, until.Format(time.RFC3339))
+		respondWithJob(c, jobManager, jobID)
+	}
+}
+
+// Handler: /api/jobs/:id/webhooks
+// Returns the webhook delivery log of a job
+func WebhookLogHandler(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID := c.Param("id")
+		if _, ok := loadJob(c, jobManager, jobID); !ok {
+			return
+		}
+		attempts, err := jobManager.DeliveryLog(c.Request.Context(), jobID)
+		if err != nil {
+			log.Printf("[ERROR] [WebhookLogHandler] Failed to load delivery log for job %s: %v", jobID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load delivery log", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"job_id": jobID, "deliveries": attempts})
+	}
+}
+
+// Handler: /api/dead-letters
+// Lists the caller's jobs that failed after exhausting their retries, newest
+// first; admin keys see every API key's
+func DeadLettersHandler(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		letters, err := jobManager.DeadLetters(c.Request.Context(), int64(limit))
+		if err != nil {
+			log.Printf("[ERROR] [DeadLettersHandler] Failed to list dead letters: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list dead letters", "details": err.Error()})
+			return
+		}
+		own := []jobs.DeadLetter{}
+		for _, l := range letters {
+			if canSee(c, l.Task.KeyID) {
+				own = append(own, l)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"dead_letters": own})
 	}
 }
+
+// respondWithJob reports a job as stored. Batch state is kept up to date by
+// whoever changes a child, so reading never writes.
+func respondWithJob(c *gin.Context, jobManager *jobs.Manager, jobID string) {
+	job, ok := loadJob(c, jobManager, jobID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// loadJob loads a job of the caller; another API key's job is reported as
+// not found, except to admin keys
+func loadJob(c *gin.Context, jobManager *jobs.Manager, jobID string) (*jobs.Job, bool) {
+	job, err := jobManager.GetJob(c.Request.Context(), jobID)
+	if err == nil && !canSee(c, job.KeyID) {
+		err = jobs.ErrJobNotFound
+	}
+	if errors.Is(err, jobs.ErrJobNotFound) {
+		log.Printf("[ERROR] Job not found: jobID=%s", jobID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load job", "details": err.Error()})
+		return nil, false
+	}
+	return job, true
+}
+
+// canSee reports whether the caller may see a job owned by keyID
+func canSee(c *gin.Context, keyID string) bool {
+	return keyID == auth.CallerKeyID(c) || auth.IsAdmin(c)
+}
@@ -0,0 +1,346 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"file-formatter-tools/internal/auth"
+	"file-formatter-tools/internal/config"
+	"file-formatter-tools/internal/jobs"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testKey      = "test-key"
+	otherTestKey = "other-key"
+	adminTestKey = "admin-key"
+)
+
+// newTestRouter builds the API as main does, on a MemoryStore and without S3.
+// Only routes that do not touch stored images can be exercised.
+func newTestRouter(t *testing.T) (*gin.Engine, *jobs.Manager) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("API_KEYS", testKey+","+otherTestKey+","+adminTestKey)
+	t.Setenv("ADMIN_API_KEYS", adminTestKey)
+	t.Setenv("WEBHOOK_SECRETS", testKey+"=secret")
+	cfg := config.Load()
+
+	jobManager := jobs.NewManager(jobs.NewMemoryStore(), cfg)
+	r := gin.New()
+	r.Use(auth.APIKeyAuthMiddleware(cfg.APIKeys, cfg.AdminAPIKeys))
+	RegisterRoutes(r, jobManager, nil, cfg)
+	return r, jobManager
+}
+
+func doRequest(r http.Handler, method, target string, form url.Values, header http.Header) *httptest.ResponseRecorder {
+	var body *strings.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	} else {
+		body = strings.NewReader("")
+	}
+	req := httptest.NewRequest(method, target, body)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set("X-API-Key", testKey)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response %q: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+// submitURL queues one upload-from-url job and returns its ID
+func submitURL(t *testing.T, r http.Handler, form url.Values) string {
+	t.Helper()
+	w := doRequest(r, http.MethodPost, "/api/upload-from-url", form, nil)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("upload-from-url = %d %s", w.Code, w.Body.String())
+	}
+	queued := decodeBody(t, w)["jobs"].([]interface{})
+	return queued[0].(map[string]interface{})["job_id"].(string)
+}
+
+func TestAPIKeyRequired(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	tests := []struct {
+		name   string
+		target string
+		header http.Header
+		want   int
+	}{
+		{"no key", "/api/jobs", http.Header{"X-Api-Key": {""}}, http.StatusUnauthorized},
+		{"wrong key", "/api/jobs", http.Header{"X-Api-Key": {"nope"}}, http.StatusUnauthorized},
+		{"header", "/api/jobs", nil, http.StatusOK},
+		// The query parameter is only for EventSource and WebSocket clients
+		{"query on a plain route", "/api/jobs?api_key=" + testKey, http.Header{"X-Api-Key": {""}}, http.StatusUnauthorized},
+		{"query on a stream route", "/api/progress/missing/stream?api_key=" + testKey, http.Header{"X-Api-Key": {""}}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(r, http.MethodGet, tt.target, nil, tt.header)
+			if w.Code != tt.want {
+				t.Errorf("GET %s = %d, want %d", tt.target, w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadFromURLQueuesJob(t *testing.T) {
+	r, _ := newTestRouter(t)
+	jobID := submitURL(t, r, url.Values{"url": {"https://93.184.216.34/images/cat.jpg"}, "width": {"100"}})
+
+	w := doRequest(r, http.MethodGet, "/api/jobs/"+jobID, nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET job = %d %s", w.Code, w.Body.String())
+	}
+	job := decodeBody(t, w)
+	if job["status"] != string(jobs.StatusQueued) {
+		t.Errorf("job status = %v, want queued", job["status"])
+	}
+
+	w = doRequest(r, http.MethodGet, "/api/jobs?status=queued", nil, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), jobID) {
+		t.Errorf("job list = %d %s, want it to include %s", w.Code, w.Body.String(), jobID)
+	}
+}
+
+func TestUploadFromURLRejectsBadInput(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	tests := []struct {
+		name string
+		form url.Values
+	}{
+		{"no url", url.Values{}},
+		{"not http", url.Values{"url": {"file:///etc/passwd"}}},
+		{"loopback", url.Values{"url": {"http://127.0.0.1/a.png"}}},
+		{"metadata service", url.Values{"url": {"http://169.254.169.254/latest/meta-data"}}},
+		{"private", url.Values{"url": {"http://10.0.0.5/a.png"}}},
+		{"bad mode", url.Values{"url": {"https://93.184.216.34/a.png"}, "mode": {"squash"}}},
+		{"callback to loopback", url.Values{"url": {"https://93.184.216.34/a.png"}, "callback_url": {"http://127.0.0.1/hook"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(r, http.MethodPost, "/api/upload-from-url", tt.form, nil)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("upload-from-url = %d %s, want 400", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCallbackRequiresSigningSecret(t *testing.T) {
+	r, _ := newTestRouter(t)
+	form := url.Values{"url": {"https://93.184.216.34/a.png"}, "callback_url": {"https://93.184.216.34/hook"}}
+
+	if w := doRequest(r, http.MethodPost, "/api/upload-from-url", form, nil); w.Code != http.StatusAccepted {
+		t.Errorf("with a secret = %d %s, want 202", w.Code, w.Body.String())
+	}
+	w := doRequest(r, http.MethodPost, "/api/upload-from-url", form, http.Header{"X-Api-Key": {otherTestKey}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("without a secret = %d %s, want 400", w.Code, w.Body.String())
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	r, _ := newTestRouter(t)
+	jobID := submitURL(t, r, url.Values{"url": {"https://93.184.216.34/a.png"}})
+
+	w := doRequest(r, http.MethodDelete, "/api/jobs/"+jobID, nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("cancel = %d %s", w.Code, w.Body.String())
+	}
+	if status := decodeBody(t, w)["status"]; status != string(jobs.StatusCancelled) {
+		t.Errorf("status after cancel = %v, want cancelled", status)
+	}
+	if w := doRequest(r, http.MethodDelete, "/api/jobs/"+jobID, nil, nil); w.Code != http.StatusConflict {
+		t.Errorf("second cancel = %d, want 409", w.Code)
+	}
+	if w := doRequest(r, http.MethodDelete, "/api/jobs/missing", nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("cancel of a missing job = %d, want 404", w.Code)
+	}
+}
+
+func TestJobsAreScopedToTheAPIKey(t *testing.T) {
+	r, _ := newTestRouter(t)
+	jobID := submitURL(t, r, url.Values{"url": {"https://93.184.216.34/a.png"}})
+
+	other := http.Header{"X-Api-Key": {otherTestKey}}
+	for _, tt := range []struct {
+		method, target string
+		form           url.Values
+	}{
+		{http.MethodGet, "/api/jobs/" + jobID, nil},
+		{http.MethodGet, "/api/progress/" + jobID, nil},
+		{http.MethodGet, "/api/progress/" + jobID + "/stream", nil},
+		{http.MethodGet, "/api/jobs/" + jobID + "/children", nil},
+		{http.MethodGet, "/api/jobs/" + jobID + "/webhooks", nil},
+		{http.MethodGet, "/api/jobs/" + jobID + "/events", nil},
+		{http.MethodGet, "/api/jobs/" + jobID + "/download", nil},
+		{http.MethodPost, "/api/jobs/" + jobID + "/extend", url.Values{"duration": {"1h"}}},
+		{http.MethodDelete, "/api/jobs/" + jobID, nil},
+	} {
+		if w := doRequest(r, tt.method, tt.target, tt.form, other); w.Code != http.StatusNotFound {
+			t.Errorf("%s %s by another key = %d, want 404", tt.method, tt.target, w.Code)
+		}
+	}
+	// key_id is ignored for keys that are not admin keys
+	ownerID := auth.KeyID(testKey)
+	if w := doRequest(r, http.MethodGet, "/api/jobs?key_id="+ownerID, nil, other); strings.Contains(w.Body.String(), jobID) {
+		t.Errorf("another key's list includes the job: %s", w.Body.String())
+	}
+
+	admin := http.Header{"X-Api-Key": {adminTestKey}}
+	if w := doRequest(r, http.MethodGet, "/api/jobs/"+jobID, nil, admin); w.Code != http.StatusOK {
+		t.Errorf("GET job by an admin key = %d, want 200", w.Code)
+	}
+	if w := doRequest(r, http.MethodGet, "/api/jobs?key_id="+ownerID, nil, admin); !strings.Contains(w.Body.String(), jobID) {
+		t.Errorf("admin list by key_id = %s, want the job", w.Body.String())
+	}
+	if w := doRequest(r, http.MethodGet, "/api/jobs/"+jobID+"/events", nil, nil); w.Code != http.StatusOK {
+		t.Errorf("events for the owner = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGetJobDoesNotRefreshBatch(t *testing.T) {
+	r, jobManager := newTestRouter(t)
+	ctx := context.Background()
+	keyID := auth.KeyID(testKey)
+	batchID, err := jobManager.NewJob(ctx, jobs.Spec{Type: "batch", KeyID: keyID})
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	if err := jobManager.SetBatchSize(ctx, batchID, 1); err != nil {
+		t.Fatalf("SetBatchSize: %v", err)
+	}
+	childID, err := jobManager.NewJob(ctx, jobs.Spec{Type: "resize", KeyID: keyID, ParentID: batchID})
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	// Fails the child without going through the batch refresh a worker does
+	if err := jobManager.FailJob(ctx, childID, jobs.ErrCodeProcessing, "boom"); err != nil {
+		t.Fatalf("FailJob: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		w := doRequest(r, http.MethodGet, "/api/jobs/"+batchID, nil, nil)
+		if status := decodeBody(t, w)["status"]; status != string(jobs.StatusQueued) {
+			t.Fatalf("batch status after GET = %v, want it left queued", status)
+		}
+	}
+	if err := jobManager.RefreshBatch(ctx, batchID); err != nil {
+		t.Fatalf("RefreshBatch: %v", err)
+	}
+	batch, err := jobManager.GetJob(ctx, batchID)
+	if err != nil || batch.Status != jobs.StatusFailed {
+		t.Errorf("batch after RefreshBatch = %v, %v, want failed", batch, err)
+	}
+}
+
+func TestIdempotencyKeyReplaysResponse(t *testing.T) {
+	r, _ := newTestRouter(t)
+	form := url.Values{"url": {"https://93.184.216.34/a.png"}}
+	header := http.Header{IdempotencyKeyHeader: {"retry-1"}}
+
+	first := doRequest(r, http.MethodPost, "/api/upload-from-url", form, header)
+	if first.Code != http.StatusAccepted {
+		t.Fatalf("first request = %d %s", first.Code, first.Body.String())
+	}
+	second := doRequest(r, http.MethodPost, "/api/upload-from-url", form, header)
+	if second.Code != http.StatusAccepted || second.Body.String() != first.Body.String() {
+		t.Errorf("retry = %d %s, want the first response %s", second.Code, second.Body.String(), first.Body.String())
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("retry was not marked as replayed")
+	}
+
+	other := url.Values{"url": {"https://93.184.216.34/b.png"}}
+	if w := doRequest(r, http.MethodPost, "/api/upload-from-url", other, header); w.Code != http.StatusConflict {
+		t.Errorf("same key with another payload = %d, want 409", w.Code)
+	}
+}
+
+func TestIdempotencyKeyDetachesFromClient(t *testing.T) {
+	_, jobManager := newTestRouter(t)
+	cfg := config.Load()
+	var (
+		called     bool
+		handlerErr error
+	)
+	r := gin.New()
+	r.POST("/submit", IdempotencyMiddleware(jobManager, cfg), func(c *gin.Context) {
+		called, handlerErr = true, c.Request.Context().Err()
+		c.Status(http.StatusAccepted)
+	})
+
+	for _, tt := range []struct {
+		name string
+		key  string
+		want error
+	}{
+		{"with key", "k1", nil},
+		{"without key", "", context.Canceled},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel() // the client is already gone
+		req := httptest.NewRequest(http.MethodPost, "/submit", nil).WithContext(ctx)
+		if tt.key != "" {
+			req.Header.Set(IdempotencyKeyHeader, tt.key)
+		}
+		called = false
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if !called {
+			t.Fatalf("%s: handler was not called", tt.name)
+		}
+		if handlerErr != tt.want {
+			t.Errorf("%s: handler context error = %v, want %v", tt.name, handlerErr, tt.want)
+		}
+	}
+}
+
+func TestJobOutputsLinkTrackedDownloads(t *testing.T) {
+	r, jobManager := newTestRouter(t)
+	jobID := submitURL(t, r, url.Values{"url": {"https://93.184.216.34/a.png"}})
+	outputs := []jobs.Output{
+		{ObjectName: "resize/a.png", Format: "png"},
+		{Name: "thumb", ObjectName: "pipeline/thumb.png", Format: "png"},
+	}
+	if err := jobManager.SucceedJob(context.Background(), jobID, outputs); err != nil {
+		t.Fatalf("SucceedJob: %v", err)
+	}
+
+	w := doRequest(r, http.MethodGet, "/api/jobs/"+jobID, nil, nil)
+	var job jobs.Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatalf("decode job: %v", err)
+	}
+	want := []string{
+		"/api/jobs/" + jobID + "/download?output=0",
+		"/api/jobs/" + jobID + "/download?output=thumb",
+	}
+	for i, out := range job.Outputs {
+		if out.TrackedURL != want[i] {
+			t.Errorf("output %d tracked_url = %q, want %q", i, out.TrackedURL, want[i])
+		}
+	}
+}
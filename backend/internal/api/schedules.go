@@ -0,0 +1,265 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"file-formatter-tools/internal/auth"
+	"file-formatter-tools/internal/imgproc"
+	"file-formatter-tools/internal/jobs"
+	"file-formatter-tools/internal/schedules"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scheduleRequest is the JSON body of POST /api/schedules and PUT /api/schedules/:id
+type scheduleRequest struct {
+	Name         string           `json:"name"`
+	Cron         string           `json:"cron"`
+	SourcePrefix string           `json:"source_prefix"`
+	OutputPrefix string           `json:"output_prefix"`
+	Operations   []jobs.Operation `json:"operations"`
+	Priority     string           `json:"priority"`
+	Enabled      *bool            `json:"enabled"`
+}
+
+// reservedPrefixes hold the service's own objects: uploads waiting for a
+// worker and job outputs, which are deleted when their jobs expire
+var reservedPrefixes = []string{"uploads/", "resize/", "batch/", "pipeline/"}
+
+// normalizePrefix cleans a bucket prefix into whole path segments ending in "/"
+func normalizePrefix(name, raw string) (string, error) {
+	cleaned := strings.Trim(path.Clean("/"+raw), "/")
+	if strings.TrimSpace(raw) == "" || cleaned == "" {
+		return "", errors.New(name + " must name a folder below the bucket root")
+	}
+	return cleaned + "/", nil
+}
+
+// overlaps reports whether one prefix contains the other
+func overlaps(a, b string) bool {
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+// apply validates the request and copies it onto s, computing the next run
+func (req *scheduleRequest) apply(s *jobs.Schedule) error {
+	if req.SourcePrefix == "" || req.OutputPrefix == "" {
+		return errors.New("source_prefix and output_prefix are required")
+	}
+	source, err := normalizePrefix("source_prefix", req.SourcePrefix)
+	if err != nil {
+		return err
+	}
+	output, err := normalizePrefix("output_prefix", req.OutputPrefix)
+	if err != nil {
+		return err
+	}
+	// Outputs written inside the source prefix would be picked up again by the next run
+	if overlaps(source, output) {
+		return errors.New("source_prefix and output_prefix must not overlap")
+	}
+	for _, reserved := range reservedPrefixes {
+		if overlaps(source, reserved) || overlaps(output, reserved) {
+			return errors.New("source_prefix and output_prefix must not overlap " + strings.Join(reservedPrefixes, ", "))
+		}
+	}
+	req.SourcePrefix, req.OutputPrefix = source, output
+
+	if len(req.Operations) == 0 {
+		return errors.New("at least one operation is required")
+	}
+	steps, err := jobs.PlanPipeline(req.Operations)
+	if err != nil {
+		return err
+	}
+	// Each image is written to a single object, so the steps must form a chain
+	// and only the last one may name an output
+	for i, op := range steps {
+		if i > 0 && op.Input != steps[i-1].ID {
+			return errors.New("scheduled operations must each take the previous step's image")
+		}
+		if i < len(steps)-1 && op.Output != "" {
+			return errors.New("only the last scheduled operation can have an output")
+		}
+		metadata, err := imgproc.NormalizeMetadataPolicy(op.Options.Metadata)
+		if err != nil {
+			return err
+		}
+		steps[i].Options.Metadata = metadata
+	}
+	// The runner encodes with the options of the last step
+	final := &steps[len(steps)-1]
+	final.Options.OutputFormat = final.Format
+	final.Options.Quality = final.Quality
+	req.Operations = steps
+
+	if req.Priority == "" {
+		req.Priority = jobs.PriorityLow // nightly bulk work yields to interactive requests
+	}
+	if !jobs.ValidPriority(req.Priority) {
+		return errors.New("priority must be high, normal or low")
+	}
+	next, err := schedules.Next(req.Cron, time.Now())
+	if err != nil {
+		return errors.New("invalid cron expression: " + err.Error())
+	}
+
+	s.Name = req.Name
+	s.Cron = req.Cron
+	s.SourcePrefix = req.SourcePrefix
+	s.OutputPrefix = req.OutputPrefix
+	s.Operations = req.Operations
+	s.Priority = req.Priority
+	s.Enabled = req.Enabled == nil || *req.Enabled
+	s.NextRunAt = nil
+	if s.Enabled {
+		s.NextRunAt = &next
+	}
+	return nil
+}
+
+// Handler: POST /api/schedules
+// Creates a recurring job that processes every image under a bucket prefix on a cron schedule
+func CreateScheduleHandler(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log.Printf("[INFO] [CreateScheduleHandler] Incoming request from %s", c.ClientIP())
+
+		var req scheduleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule", "details": err.Error()})
+			return
+		}
+		s := &jobs.Schedule{
+			ID:        jobs.NewID(),
+			KeyID:     auth.CallerKeyID(c),
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := req.apply(s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := jobManager.SaveSchedule(c.Request.Context(), s); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save schedule", "details": err.Error()})
+			return
+		}
+		log.Printf("[INFO] [CreateScheduleHandler] Created scheduleID=%s, cron=%q", s.ID, s.Cron)
+		c.JSON(http.StatusCreated, s)
+	}
+}
+
+// Handler: GET /api/schedules
+func ListSchedulesHandler(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := jobManager.ListSchedules(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list schedules", "details": err.Error()})
+			return
+		}
+		// Each API key only sees its own schedules
+		own := []*jobs.Schedule{}
+		for _, s := range list {
+			if s.KeyID == auth.CallerKeyID(c) {
+				own = append(own, s)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"schedules": own})
+	}
+}
+
+// Handler: GET /api/schedules/:id
+func ScheduleHandler(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s, ok := loadSchedule(c, jobManager)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+// Handler: PUT /api/schedules/:id
+// Replaces the definition; run history is kept
+func UpdateScheduleHandler(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s, ok := loadSchedule(c, jobManager)
+		if !ok {
+			return
+		}
+		var req scheduleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule", "details": err.Error()})
+			return
+		}
+		if err := req.apply(s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := jobManager.SaveSchedule(c.Request.Context(), s); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save schedule", "details": err.Error()})
+			return
+		}
+		log.Printf("[INFO] [UpdateScheduleHandler] Updated scheduleID=%s", s.ID)
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+// Handler: DELETE /api/schedules/:id
+// Stops future runs; batch jobs of past runs are kept until they expire
+func DeleteScheduleHandler(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s, ok := loadSchedule(c, jobManager)
+		if !ok {
+			return
+		}
+		scheduleID := s.ID
+		err := jobManager.DeleteSchedule(c.Request.Context(), scheduleID)
+		if errors.Is(err, jobs.ErrScheduleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete schedule", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"schedule_id": scheduleID, "deleted": true})
+	}
+}
+
+// Handler: GET /api/schedules/:id/runs
+// Lists the batch jobs created by past runs, newest first
+func ScheduleRunsHandler(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s, ok := loadSchedule(c, jobManager)
+		if !ok {
+			return
+		}
+		runs, err := jobManager.ScheduleRuns(c.Request.Context(), s.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load runs", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"schedule_id": s.ID, "runs": runs})
+	}
+}
+
+// loadSchedule loads the schedule named in the path; another API key's
+// schedule is reported as not found
+func loadSchedule(c *gin.Context, jobManager *jobs.Manager) (*jobs.Schedule, bool) {
+	s, err := jobManager.GetSchedule(c.Request.Context(), c.Param("id"))
+	if err == nil && s.KeyID != auth.CallerKeyID(c) {
+		err = jobs.ErrScheduleNotFound
+	}
+	if errors.Is(err, jobs.ErrScheduleNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load schedule", "details": err.Error()})
+		return nil, false
+	}
+	return s, true
+}
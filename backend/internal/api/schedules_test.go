@@ -0,0 +1,122 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"file-formatter-tools/internal/jobs"
+)
+
+func TestScheduleRequestApply(t *testing.T) {
+	resize := jobs.Operation{Type: "resize", Options: jobs.ResizeOptions{Width: 100}}
+	tests := []struct {
+		name    string
+		source  string
+		output  string
+		ops     []jobs.Operation
+		wantErr string
+	}{
+		{"valid", "photos", "thumbs", []jobs.Operation{resize}, ""},
+		{"sibling with a common name prefix", "in", "input", []jobs.Operation{resize}, ""},
+		{"output inside source", "photos", "photos/thumbs", []jobs.Operation{resize}, "must not overlap"},
+		{"source inside output", "thumbs/raw/", "/thumbs", []jobs.Operation{resize}, "must not overlap"},
+		{"same folder", "photos/", "./photos", []jobs.Operation{resize}, "must not overlap"},
+		{"bucket root", "/", "thumbs", []jobs.Operation{resize}, "below the bucket root"},
+		{"reserved source", "uploads", "thumbs", []jobs.Operation{resize}, "must not overlap uploads/"},
+		{"reserved output", "photos", "batch/nightly", []jobs.Operation{resize}, "must not overlap uploads/"},
+		{"escaping the root", "../resize", "thumbs", []jobs.Operation{resize}, "must not overlap uploads/"},
+		{"no operations", "photos", "thumbs", nil, "at least one operation"},
+		{"invalid step", "photos", "thumbs", []jobs.Operation{{Type: "resize"}}, "positive width or height"},
+		{"unknown step", "photos", "thumbs", []jobs.Operation{{Type: "blur"}}, "unsupported operation type"},
+		{
+			"crop and watermark chain", "photos", "thumbs",
+			[]jobs.Operation{{Type: "crop", Crop: &jobs.CropOptions{Aspect: "1:1"}}, resize, {Type: "watermark", Watermark: &jobs.WatermarkOptions{Text: "(c)"}}},
+			"",
+		},
+		{
+			"branching steps", "photos", "thumbs",
+			[]jobs.Operation{{ID: "a", Type: "resize", Options: jobs.ResizeOptions{Width: 10}}, {ID: "b", Input: jobs.SourceStep, Type: "resize", Options: jobs.ResizeOptions{Width: 20}}},
+			"previous step's image",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := scheduleRequest{Cron: "0 3 * * *", SourcePrefix: tt.source, OutputPrefix: tt.output, Operations: tt.ops}
+			err := req.apply(&jobs.Schedule{})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("apply = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("apply = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScheduleRequestApplyNormalizes(t *testing.T) {
+	req := scheduleRequest{
+		Cron:         "0 3 * * *",
+		SourcePrefix: "/photos//2024",
+		OutputPrefix: "thumbs",
+		Operations:   []jobs.Operation{{Type: "resize", Options: jobs.ResizeOptions{Width: 100, OutputFormat: "webp"}}},
+	}
+	s := &jobs.Schedule{}
+	if err := req.apply(s); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if s.SourcePrefix != "photos/2024/" || s.OutputPrefix != "thumbs/" {
+		t.Errorf("prefixes = %q, %q", s.SourcePrefix, s.OutputPrefix)
+	}
+	final := s.Operations[len(s.Operations)-1]
+	if final.Options.OutputFormat != "webp" || final.Options.Quality != 85 {
+		t.Errorf("final step encodes as %q at quality %d", final.Options.OutputFormat, final.Options.Quality)
+	}
+	if s.Priority != jobs.PriorityLow || !s.Enabled || s.NextRunAt == nil {
+		t.Errorf("defaults: priority=%s enabled=%v next=%v", s.Priority, s.Enabled, s.NextRunAt)
+	}
+}
+
+func TestSchedulesAreScopedToTheAPIKey(t *testing.T) {
+	r, _ := newTestRouter(t)
+	body, _ := json.Marshal(scheduleRequest{
+		Cron:         "0 3 * * *",
+		SourcePrefix: "photos",
+		OutputPrefix: "thumbs",
+		Operations:   []jobs.Operation{{Type: "resize", Options: jobs.ResizeOptions{Width: 100}}},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/schedules", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", testKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", w.Code, w.Body.String())
+	}
+	id := decodeBody(t, w)["schedule_id"].(string)
+
+	other := http.Header{"X-Api-Key": {otherTestKey}}
+	for _, tt := range []struct{ method, target string }{
+		{http.MethodGet, "/api/schedules/" + id},
+		{http.MethodPut, "/api/schedules/" + id},
+		{http.MethodGet, "/api/schedules/" + id + "/runs"},
+		{http.MethodDelete, "/api/schedules/" + id},
+	} {
+		if w := doRequest(r, tt.method, tt.target, nil, other); w.Code != http.StatusNotFound {
+			t.Errorf("%s %s by another key = %d, want 404", tt.method, tt.target, w.Code)
+		}
+	}
+	if w := doRequest(r, http.MethodGet, "/api/schedules", nil, other); strings.Contains(w.Body.String(), id) {
+		t.Errorf("another key's list includes the schedule: %s", w.Body.String())
+	}
+
+	if w := doRequest(r, http.MethodGet, "/api/schedules", nil, nil); !strings.Contains(w.Body.String(), id) {
+		t.Errorf("owner's list = %s, want the schedule", w.Body.String())
+	}
+	if w := doRequest(r, http.MethodDelete, "/api/schedules/"+id, nil, nil); w.Code != http.StatusOK {
+		t.Errorf("delete by the owner = %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"file-formatter-tools/internal/jobs"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const streamKeepAlive = 15 * time.Second
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Requests are authenticated by API key, not by cookies, so any origin may connect
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// Handler: /api/progress/:jobID/stream
+// Pushes every job state change as a Server-Sent Event until the job finishes
+func ProgressStreamHandler(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID := c.Param("jobID")
+		log.Printf("[INFO] [ProgressStreamHandler] SSE stream for jobID=%s from %s", jobID, c.ClientIP())
+
+		if _, ok := loadJob(c, jobManager, jobID); !ok {
+			return
+		}
+		updates, err := jobManager.Watch(c.Request.Context(), jobID)
+		if errors.Is(err, jobs.ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("[ERROR] [ProgressStreamHandler] Failed to watch job %s: %v", jobID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not watch job"})
+			return
+		}
+
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no") // disable nginx buffering
+
+		ticker := time.NewTicker(streamKeepAlive)
+		defer ticker.Stop()
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case job, ok := <-updates:
+				if !ok {
+					return false
+				}
+				c.SSEvent("progress", job)
+				return true
+			case <-ticker.C:
+				// SSE comment line, keeps idle proxies from closing the connection
+				_, err := io.WriteString(w, ": keep-alive\n\n")
+				return err == nil
+			}
+		})
+		log.Printf("[INFO] [ProgressStreamHandler] SSE stream closed for jobID=%s", jobID)
+	}
+}
+
+// Handler: /api/progress/:jobID/ws
+// Same as the SSE stream but over a WebSocket; the server closes it once the job finishes
+func ProgressWebSocketHandler(jobManager *jobs.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID := c.Param("jobID")
+		log.Printf("[INFO] [ProgressWebSocketHandler] WebSocket for jobID=%s from %s", jobID, c.ClientIP())
+
+		ctx := c.Request.Context()
+		if _, ok := loadJob(c, jobManager, jobID); !ok {
+			return
+		}
+		updates, err := jobManager.Watch(ctx, jobID)
+		if errors.Is(err, jobs.ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("[ERROR] [ProgressWebSocketHandler] Failed to watch job %s: %v", jobID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not watch job"})
+			return
+		}
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			log.Printf("[ERROR] [ProgressWebSocketHandler] Upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		// Drain client messages so close frames and pongs are processed
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+
+		ticker := time.NewTicker(streamKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case job, ok := <-updates:
+				if !ok {
+					msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "job finished")
+					_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+					log.Printf("[INFO] [ProgressWebSocketHandler] WebSocket closed for jobID=%s", jobID)
+					return
+				}
+				if err := conn.WriteJSON(job); err != nil {
+					return
+				}
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second)); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	}
+}
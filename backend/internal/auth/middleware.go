@@ -1,20 +1,56 @@
 package auth
 
 import (
-	"log"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func APIKeyAuthMiddleware(allowedKeys []string) gin.HandlerFunc {
+// Gin context keys holding the caller's API key ID and whether it is an admin key
+const (
+	ContextKeyID = "api_key_id"
+	ContextAdmin = "api_key_admin"
+)
+
+// KeyID returns a stable, non-secret identifier for an API key, safe to store
+// on job records and show to support staff
+func KeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:6])
+}
+
+// CallerKeyID returns the API key ID of the authenticated request
+func CallerKeyID(c *gin.Context) string {
+	return c.GetString(ContextKeyID)
+}
+
+// IsAdmin reports whether the request used one of ADMIN_API_KEYS, which may
+// see the jobs of every API key
+func IsAdmin(c *gin.Context) bool {
+	return c.GetBool(ContextAdmin)
+}
+
+// queryKeyRoutes may pass the API key as ?api_key=: EventSource and WebSocket
+// clients in browsers cannot set headers. Elsewhere it would end up in logs
+// and browser history, so only the header is accepted.
+var queryKeyRoutes = map[string]bool{
+	"/api/progress/:jobID/stream": true,
+	"/api/progress/:jobID/ws":     true,
+}
+
+func APIKeyAuthMiddleware(allowedKeys, adminKeys []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		key := c.GetHeader("X-API-Key")
-		log.Printf("[DEBUG] Received API key: %s", key)
+		if key == "" && queryKeyRoutes[c.FullPath()] {
+			key = c.Query("api_key")
+		}
 		for _, allowed := range allowedKeys {
 			if key == strings.TrimSpace(allowed) && key != "" {
-				log.Printf("[DEBUG] API key is valid: %s", key)
+				c.Set(ContextKeyID, KeyID(key))
+				c.Set(ContextAdmin, contains(adminKeys, key))
 				c.Next()
 				return
 			}
@@ -22,3 +58,12 @@ func APIKeyAuthMiddleware(allowedKeys []string) gin.HandlerFunc {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
 	}
 }
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if strings.TrimSpace(k) == key {
+			return true
+		}
+	}
+	return false
+}
@@ -2,32 +2,226 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
+	// JobStore is where jobs and queues live: "redis" (a single Redis 7 node,
+	// not a cluster), or "memory" for a single process that needs no Redis
+	// (state is lost on restart)
+	JobStore    string
 	RedisAddr   string
 	S3Endpoint  string
 	S3AccessKey string
 	S3SecretKey string
 	S3Bucket    string
 	APIKeys     []string
+	// AdminAPIKeys (also listed in APIKeys) may see every API key's jobs;
+	// other keys only see their own
+	AdminAPIKeys []string
+
+	// Mode selects what the binary runs: "all" (API + workers), "api" or "worker"
+	Mode        string
+	WorkerCount int
+
+	// A worker holds a lease on its job, renewed while it runs; a job whose
+	// lease runs out (e.g. the worker crashed) is put back in the queue
+	WorkerLeaseTTL time.Duration
+	// Cap on jobs running at once per API key across all replicas, 0 = none
+	MaxJobsPerKey int
+
+	// Scheduling: "fair" (priorities, round-robin between API keys) or "fifo";
+	// TenantWeights gives an API key more consecutive turns in the rotation
+	SchedulerPolicy string
+	TenantWeights   map[string]int
+
+	// Retry policy for transient job failures
+	JobMaxAttempts    int
+	JobRetryBaseDelay time.Duration
+	JobRetryMaxDelay  time.Duration
+
+	// Retention: how long job records, result objects and download links live
+	JobRetention       time.Duration
+	ResultRetention    time.Duration
+	PresignedURLExpiry time.Duration
+	MaxRetention       time.Duration // upper bound for /api/jobs/:id/extend
+
+	// Reuse the result of an earlier job with the same input and options
+	ResultCache bool
+
+	// Webhooks: signing secret per API key, delivery attempts, HTTP timeout
+	// and how many deliveries are sent at once
+	WebhookSecrets     map[string]string
+	WebhookMaxAttempts int
+	WebhookTimeout     time.Duration
+	WebhookConcurrency int
+
+	// How long an Idempotency-Key and its stored response are kept
+	IdempotencyTTL time.Duration
+
+	// How far ahead a job may be scheduled with run_at or delay
+	MaxScheduleDelay time.Duration
+
+	// Fetching images for /api/upload-from-url. Private, loopback and
+	// link-local addresses are refused unless listed in FetchAllowedNetworks
+	// (CIDRs or single addresses).
+	FetchAllowedNetworks []string
+	FetchMaxBytes        int64
+	FetchTimeout         time.Duration
+	FetchMaxRedirects    int
+	FetchMaxURLs         int // per request
 }
 
+// S3 rejects presigned URLs valid for longer than a week
+const maxPresignedURLExpiry = 7 * 24 * time.Hour
+
 func Load() *Config {
-	return &Config{
+	cfg := &Config{
+		JobStore:    getEnv("JOB_STORE", "redis"),
 		RedisAddr:   getEnv("REDIS_ADDR", "localhost:6379"),
 		S3Endpoint:  getEnv("S3_ENDPOINT", "localhost:9000"),
 		S3AccessKey: getEnv("S3_ACCESS_KEY", ""),
 		S3SecretKey: getEnv("S3_SECRET_KEY", ""),
 		S3Bucket:    getEnv("S3_BUCKET", "images"),
 		APIKeys:     strings.Split(getEnv("API_KEYS", "changeme"), ","),
+		Mode:        getEnv("MODE", "all"),
+		WorkerCount: getEnvInt("WORKER_COUNT", 4),
+
+		AdminAPIKeys: splitList(getEnv("ADMIN_API_KEYS", "")),
+
+		WorkerLeaseTTL: getEnvDuration("WORKER_LEASE_TTL", 30*time.Second),
+		MaxJobsPerKey:  getEnvInt("MAX_JOBS_PER_KEY", 0),
+
+		SchedulerPolicy: getEnv("SCHEDULER_POLICY", "fair"),
+		TenantWeights:   parseWeights(getEnv("TENANT_WEIGHTS", "")),
+
+		JobMaxAttempts:    getEnvInt("JOB_MAX_ATTEMPTS", 3),
+		JobRetryBaseDelay: getEnvDuration("JOB_RETRY_BASE_DELAY", 2*time.Second),
+		JobRetryMaxDelay:  getEnvDuration("JOB_RETRY_MAX_DELAY", time.Minute),
+
+		JobRetention:       getEnvDuration("JOB_RETENTION", 24*time.Hour),
+		ResultRetention:    getEnvDuration("RESULT_RETENTION", 24*time.Hour),
+		PresignedURLExpiry: getEnvDuration("PRESIGNED_URL_EXPIRY", 10*time.Hour),
+		MaxRetention:       getEnvDuration("MAX_RETENTION", 7*24*time.Hour),
+
+		ResultCache: getEnvBool("RESULT_CACHE", true),
+
+		WebhookSecrets:     parsePairs(getEnv("WEBHOOK_SECRETS", "")),
+		WebhookMaxAttempts: getEnvInt("WEBHOOK_MAX_ATTEMPTS", 5),
+		WebhookTimeout:     getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookConcurrency: getEnvInt("WEBHOOK_CONCURRENCY", 10),
+
+		IdempotencyTTL: getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+
+		MaxScheduleDelay: getEnvDuration("MAX_SCHEDULE_DELAY", 7*24*time.Hour),
+
+		FetchAllowedNetworks: splitList(getEnv("FETCH_ALLOWED_NETWORKS", "")),
+		FetchMaxBytes:        int64(getEnvInt("FETCH_MAX_BYTES", 20<<20)),
+		FetchTimeout:         getEnvDuration("FETCH_TIMEOUT", 30*time.Second),
+		FetchMaxRedirects:    getEnvInt("FETCH_MAX_REDIRECTS", 3),
+		FetchMaxURLs:         getEnvInt("FETCH_MAX_URLS", 20),
+	}
+	cfg.normalizeRetention()
+	// Leases are renewed every third of their TTL
+	if cfg.WorkerLeaseTTL < 3*time.Second {
+		cfg.WorkerLeaseTTL = 3 * time.Second
+	}
+	return cfg
+}
+
+// normalizeRetention keeps the retention settings consistent: a job record
+// outlives its results, and a download link never outlives the object
+func (c *Config) normalizeRetention() {
+	if c.JobRetention < c.ResultRetention {
+		c.JobRetention = c.ResultRetention
+	}
+	if c.PresignedURLExpiry > c.ResultRetention {
+		c.PresignedURLExpiry = c.ResultRetention
+	}
+	if c.PresignedURLExpiry > maxPresignedURLExpiry {
+		c.PresignedURLExpiry = maxPresignedURLExpiry
+	}
+	if c.MaxRetention < c.JobRetention {
+		c.MaxRetention = c.JobRetention
 	}
 }
 
+// URLExpiry returns how long a download link re-issued for a result kept until
+// retainUntil may be valid, within the S3 limit
+func (c *Config) URLExpiry(retainUntil time.Time) time.Duration {
+	expiry := time.Until(retainUntil)
+	if expiry > maxPresignedURLExpiry {
+		expiry = maxPresignedURLExpiry
+	}
+	return expiry
+}
+
 func getEnv(key, fallback string) string {
 	if val := os.Getenv(key); val != "" {
 		return val
 	}
 	return fallback
 }
+
+func getEnvInt(key string, fallback int) int {
+	if val := os.Getenv(key); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if val := os.Getenv(key); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
+// splitList reads "a,b" into a slice, dropping empty items
+func splitList(raw string) []string {
+	items := []string{}
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parsePairs reads "key1=value1,key2=value2" into a map
+func parsePairs(raw string) map[string]string {
+	pairs := map[string]string{}
+	for _, item := range strings.Split(raw, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if ok && k != "" {
+			pairs[k] = v
+		}
+	}
+	return pairs
+}
+
+// parseWeights reads "key1=3,key2=1" into a map, ignoring invalid weights
+func parseWeights(raw string) map[string]int {
+	weights := map[string]int{}
+	for k, v := range parsePairs(raw) {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			weights[k] = n
+		}
+	}
+	return weights
+}
@@ -0,0 +1,115 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"file-formatter-tools/internal/config"
+)
+
+var (
+	ErrInvalidURL       = errors.New("invalid URL")
+	ErrBlockedAddress   = errors.New("address is not allowed")
+	ErrTooLarge         = errors.New("image is too large")
+	ErrNotImage         = errors.New("content is not a supported image")
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// imageTypes are the sniffed content types accepted, as named by http.DetectContentType
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Fetcher downloads images from user-supplied URLs, only from addresses its
+// Guard allows
+type Fetcher struct {
+	client   *http.Client
+	guard    *Guard
+	maxBytes int64
+}
+
+func New(cfg *config.Config) *Fetcher {
+	f := &Fetcher{guard: NewGuard(cfg), maxBytes: cfg.FetchMaxBytes}
+	maxRedirects := cfg.FetchMaxRedirects
+	f.client = &http.Client{
+		Timeout:   cfg.FetchTimeout,
+		Transport: f.guard.Transport(cfg.FetchTimeout),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return ErrTooManyRedirects
+			}
+			return ValidateURL(req.URL.String())
+		},
+	}
+	return f
+}
+
+// CheckURL validates a URL before it is queued, see Guard.CheckURL
+func (f *Fetcher) CheckURL(raw string) error {
+	return f.guard.CheckURL(raw)
+}
+
+// Fetch downloads an image, enforcing the size limit, and returns it with
+// its content type as sniffed from the data (the server's header is ignored)
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) ([]byte, string, error) {
+	if err := f.CheckURL(rawURL); err != nil {
+		return nil, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", &StatusError{Code: resp.StatusCode}
+	}
+	if resp.ContentLength > f.maxBytes {
+		return nil, "", fmt.Errorf("%w: %d bytes, the limit is %d", ErrTooLarge, resp.ContentLength, f.maxBytes)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > f.maxBytes {
+		return nil, "", fmt.Errorf("%w: the limit is %d bytes", ErrTooLarge, f.maxBytes)
+	}
+	contentType := http.DetectContentType(data)
+	if !imageTypes[contentType] {
+		return nil, "", fmt.Errorf("%w: detected %s", ErrNotImage, contentType)
+	}
+	return data, contentType, nil
+}
+
+// StatusError is a non-200 response from the image server
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server responded with %d %s", e.Code, http.StatusText(e.Code))
+}
+
+// IsPermanent reports whether fetching again cannot succeed: the address is
+// refused, the content is unusable, or the server rejected the request.
+// Timeouts, connection errors and 5xx/429 responses may be retried.
+func IsPermanent(err error) bool {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Code < 500 && status.Code != http.StatusTooManyRequests && status.Code != http.StatusRequestTimeout
+	}
+	return errors.Is(err, ErrInvalidURL) || errors.Is(err, ErrBlockedAddress) || errors.Is(err, ErrTooLarge) ||
+		errors.Is(err, ErrNotImage) || errors.Is(err, ErrTooManyRedirects)
+}
@@ -0,0 +1,160 @@
+package fetch
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"file-formatter-tools/internal/config"
+)
+
+// reserved are special-purpose ranges not covered by the net.IP predicates
+var reserved = mustParseCIDRs("0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4", "64:ff9b:1::/48")
+
+// IPv6 ranges that carry an IPv4 address, which a gateway may connect to
+var (
+	nat64     = mustParseCIDRs("64:ff9b::/96")[0]
+	sixToFour = mustParseCIDRs("2002::/16")[0]
+)
+
+// Guard keeps outgoing requests to user-supplied URLs on public addresses:
+// private, loopback, link-local and other special ranges are refused unless
+// allow-listed in FETCH_ALLOWED_NETWORKS. The check runs on the address
+// actually dialed, after DNS resolution and on every redirect, so a hostname
+// cannot be pointed at an internal service.
+type Guard struct {
+	allowed []*net.IPNet
+}
+
+func NewGuard(cfg *config.Config) *Guard {
+	g := &Guard{}
+	for _, raw := range cfg.FetchAllowedNetworks {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		cidr := raw
+		if !strings.Contains(raw, "/") {
+			// A single address
+			if ip := net.ParseIP(raw); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Printf("[WARN] [Fetch] Ignoring invalid allow-listed network %q: %v", raw, err)
+			continue
+		}
+		g.allowed = append(g.allowed, network)
+	}
+	return g
+}
+
+// Transport returns an HTTP transport that only dials allowed addresses
+func (g *Guard) Transport(responseTimeout time.Duration) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			return g.CheckIP(net.ParseIP(host))
+		},
+	}
+	return &http.Transport{
+		// No proxy: it would make the connection on our behalf, past the address check
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: responseTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+}
+
+// ValidateURL checks that a URL is an absolute http(s) URL without credentials
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("%w: %q is not an absolute http(s) URL", ErrInvalidURL, raw)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: %q must not contain credentials", ErrInvalidURL, raw)
+	}
+	return nil
+}
+
+// CheckURL validates a URL and, if its host is a literal IP address, that
+// the address may be dialed. Hostnames are checked when they are dialed.
+func (g *Guard) CheckURL(raw string) error {
+	if err := ValidateURL(raw); err != nil {
+		return err
+	}
+	u, _ := url.Parse(raw)
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		return g.CheckIP(ip)
+	}
+	return nil
+}
+
+// CheckIP returns ErrBlockedAddress unless ip is public or allow-listed
+func (g *Guard) CheckIP(ip net.IP) error {
+	if ip == nil {
+		return ErrBlockedAddress
+	}
+	for _, network := range g.allowed {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+	if v4 := embeddedIPv4(ip); v4 != nil {
+		if err := g.CheckIP(v4); err != nil {
+			return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+		}
+		return nil
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+	}
+	for _, network := range reserved {
+		if network.Contains(ip) {
+			return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+		}
+	}
+	return nil
+}
+
+// embeddedIPv4 returns the IPv4 address a NAT64 or 6to4 address leads to
+func embeddedIPv4(ip net.IP) net.IP {
+	if ip.To4() != nil {
+		return nil
+	}
+	switch {
+	case nat64.Contains(ip):
+		return ip.To16()[12:16]
+	case sixToFour.Contains(ip):
+		return ip.To16()[2:6]
+	}
+	return nil
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
@@ -0,0 +1,172 @@
+package imgproc
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"strings"
+
+	"github.com/chai2010/webp"
+	"github.com/disintegration/imaging"
+)
+
+// ErrSizeLimit is returned, with the smallest encoding found, when an image
+// cannot be made to fit its size limit
+var ErrSizeLimit = errors.New("could not fit image into the size limit")
+
+const (
+	minQuality    = 10 // lossy formats are not compressed further than this
+	minDimension  = 16 // nor downscaled below this many pixels on the shorter side
+	maxDownscales = 8
+)
+
+// Encoded is an encoded image and the settings it was written with
+type Encoded struct {
+	Data    []byte
+	Quality int // of jpeg and webp; 0 for png and gif
+	Width   int
+	Height  int
+	Palette bool // a png reduced to 256 colors to fit the size limit
+}
+
+// Encode compresses img in the given format. If maxSizeKB is set and the
+// image is too large at the given quality, lossy formats get the highest
+// quality that fits, found by binary search; png is reduced to a palette.
+// If that is not enough, the image is downscaled step by step.
+func Encode(img image.Image, format string, quality int, maxSizeKB int) (*Encoded, error) {
+	format = strings.ToLower(format)
+	if format != "png" && format != "gif" && format != "webp" {
+		format = "jpeg"
+		img = flatten(img)
+	}
+	if maxSizeKB <= 0 {
+		return encodeAt(img, format, quality, false)
+	}
+
+	limit := maxSizeKB * 1024
+	var best *Encoded
+	for i := 0; ; i++ {
+		fitted, smallest, err := fitSize(img, format, quality, limit)
+		if err != nil || fitted != nil {
+			return fitted, err
+		}
+		if best == nil || len(smallest.Data) < len(best.Data) {
+			best = smallest
+		}
+
+		// Size is roughly proportional to the pixel count; aim a little below the limit
+		scale := math.Sqrt(float64(limit)/float64(len(smallest.Data))) * 0.9
+		scale = math.Max(0.5, math.Min(scale, 0.9))
+		w := int(math.Round(float64(img.Bounds().Dx()) * scale))
+		h := int(math.Round(float64(img.Bounds().Dy()) * scale))
+		if i == maxDownscales || min(w, h) < minDimension {
+			return best, ErrSizeLimit
+		}
+		img = imaging.Resize(img, w, h, imaging.Lanczos)
+	}
+}
+
+// fitSize encodes img at its current size within limit bytes, at the highest
+// quality that fits. Without a fit it returns the smallest encoding instead.
+func fitSize(img image.Image, format string, quality, limit int) (fitted, smallest *Encoded, err error) {
+	switch format {
+	case "jpeg", "webp":
+		// Sizes fall with quality, so check the ends before searching between them
+		top, err := encodeAt(img, format, quality, false)
+		if err != nil || len(top.Data) <= limit {
+			return top, nil, err
+		}
+		// Never search below minQuality; at or under it there is nothing lower to try
+		lo := minQuality
+		if lo >= quality {
+			return nil, top, nil
+		}
+		bottom, err := encodeAt(img, format, lo, false)
+		if err != nil || len(bottom.Data) > limit {
+			return nil, bottom, err
+		}
+		fitted = bottom
+		for lo, hi := lo+1, quality-1; lo <= hi; {
+			mid := (lo + hi) / 2
+			enc, err := encodeAt(img, format, mid, false)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(enc.Data) <= limit {
+				fitted, lo = enc, mid+1
+			} else {
+				hi = mid - 1
+			}
+		}
+		return fitted, nil, nil
+	case "png":
+		full, err := encodeAt(img, format, 0, false)
+		if err != nil || len(full.Data) <= limit {
+			return full, nil, err
+		}
+		reduced, err := encodeAt(img, format, 0, true)
+		if err != nil || len(reduced.Data) <= limit {
+			return reduced, nil, err
+		}
+		if len(full.Data) < len(reduced.Data) {
+			return nil, full, nil
+		}
+		return nil, reduced, nil
+	}
+	enc, err := encodeAt(img, format, quality, false)
+	if err != nil || len(enc.Data) <= limit {
+		return enc, nil, err
+	}
+	return nil, enc, nil
+}
+
+// flatten composites an image with transparency onto white, for jpeg, which
+// has no alpha channel and would otherwise show transparent pixels as black
+func flatten(img image.Image) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+	b := img.Bounds()
+	return imaging.Overlay(imaging.New(b.Dx(), b.Dy(), color.White), img, image.Pt(0, 0), 1)
+}
+
+// encodeAt encodes img once; palette reduces a png to 256 colors
+func encodeAt(img image.Image, format string, quality int, palette bool) (*Encoded, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		if palette {
+			b := img.Bounds()
+			paletted := image.NewPaletted(b, medianCut{}.Quantize(make([]color.Color, 0, 256), img))
+			draw.FloydSteinberg.Draw(paletted, b, img, b.Min)
+			err = png.Encode(&buf, paletted)
+		} else {
+			err = png.Encode(&buf, img)
+		}
+		quality = 0
+	case "gif":
+		err = gif.Encode(&buf, img, &gif.Options{NumColors: 256, Quantizer: medianCut{}})
+		quality = 0
+	case "webp":
+		err = webp.Encode(&buf, img, &webp.Options{Quality: float32(quality)})
+	default:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Encoded{
+		Data:    buf.Bytes(),
+		Quality: quality,
+		Width:   img.Bounds().Dx(),
+		Height:  img.Bounds().Dy(),
+		Palette: palette,
+	}, nil
+}
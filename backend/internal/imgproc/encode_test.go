@@ -0,0 +1,102 @@
+package imgproc
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// noise is hard to compress, so size limits force lower qualities
+func noise(w, h int) *image.NRGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rng.Intn(256))
+	}
+	return img
+}
+
+func TestEncodeFitsSizeLimit(t *testing.T) {
+	img := noise(256, 256)
+	for _, format := range []string{"jpeg", "webp"} {
+		enc, err := Encode(img, format, 90, 40)
+		if err != nil {
+			t.Fatalf("Encode %s: %v", format, err)
+		}
+		if len(enc.Data) > 40*1024 {
+			t.Errorf("%s is %d bytes, over the limit", format, len(enc.Data))
+		}
+		if enc.Quality < minQuality || enc.Quality >= 90 {
+			t.Errorf("%s quality = %d, want between %d and 90", format, enc.Quality, minQuality)
+		}
+	}
+}
+
+func TestEncodeNeverGoesBelowMinQuality(t *testing.T) {
+	img := noise(64, 64)
+	// An impossible limit downscales rather than dropping quality further
+	enc, err := Encode(img, "jpeg", 90, 1)
+	if !errors.Is(err, ErrSizeLimit) && err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if enc.Quality < minQuality {
+		t.Errorf("quality = %d, below %d", enc.Quality, minQuality)
+	}
+
+	// A requested quality under the floor is kept as it is
+	enc, err = Encode(img, "jpeg", 5, 1)
+	if !errors.Is(err, ErrSizeLimit) && err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if enc.Quality != 5 {
+		t.Errorf("quality = %d, want the requested 5", enc.Quality)
+	}
+}
+
+func TestEncodePaletteFallback(t *testing.T) {
+	// Few distinct colors: a palette png is much smaller than a truecolor one
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	rng := rand.New(rand.NewSource(2))
+	colors := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {255, 255, 255, 255}}
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			img.SetNRGBA(x, y, colors[rng.Intn(len(colors))])
+		}
+	}
+	full, err := Encode(img, "png", 0, 0)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	limit := len(full.Data) / 1024 * 3 / 4
+	enc, err := Encode(img, "png", 0, limit)
+	if err != nil {
+		t.Fatalf("Encode within %d KB: %v", limit, err)
+	}
+	if !enc.Palette || enc.Width != 256 {
+		t.Errorf("palette=%v width=%d, want a full-size palette png", enc.Palette, enc.Width)
+	}
+}
+
+func TestEncodeJPEGFlattensTransparency(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := range src.Pix {
+		src.Pix[i] = 255
+	}
+	padded := Resize(src, ResizeSpec{Width: 32, Height: 8, Mode: ModePad, Background: "transparent"})
+
+	enc, err := Encode(padded, "jpeg", 90, 0)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	img, _, err := Decode(enc.Data)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	// The padding would come out black without flattening
+	r, g, b, _ := img.At(1, 4).RGBA()
+	if r>>8 < 240 || g>>8 < 240 || b>>8 < 240 {
+		t.Errorf("padding is %d,%d,%d, want white", r>>8, g>>8, b>>8)
+	}
+}
@@ -0,0 +1,40 @@
+package imgproc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Formats are the output formats Encode supports
+var Formats = []string{"jpeg", "png", "gif", "webp"}
+
+// NormalizeFormat returns the canonical name of an output format, accepting
+// "jpg" and any case for "jpeg". An empty name stays empty.
+func NormalizeFormat(name string) (string, error) {
+	format := strings.ToLower(strings.TrimSpace(name))
+	if format == "jpg" {
+		format = "jpeg"
+	}
+	if format == "" {
+		return "", nil
+	}
+	for _, f := range Formats {
+		if format == f {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported output format %q, expected one of %s", name, strings.Join(Formats, ", "))
+}
+
+// Extension returns the file extension for a format, without the dot
+func Extension(format string) string {
+	if format == "jpeg" {
+		return "jpg"
+	}
+	return format
+}
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+	return "image/" + format
+}
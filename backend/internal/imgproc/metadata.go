@@ -0,0 +1,355 @@
+package imgproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"sort"
+	"strings"
+
+	"github.com/chai2010/webp"
+	"github.com/disintegration/imaging"
+)
+
+// Metadata policies: which EXIF data of the input the output keeps. The
+// encoders write no metadata of their own, so nothing else is carried over.
+// Location data is dropped under every policy.
+const (
+	MetadataStrip    = "strip"    // none (the default)
+	MetadataSafe     = "safe"     // author, copyright and capture date
+	MetadataPreserve = "preserve" // everything except location, maker notes, XMP and the thumbnail
+)
+
+// MetadataPolicies are the policies NormalizeMetadataPolicy accepts
+var MetadataPolicies = []string{MetadataStrip, MetadataSafe, MetadataPreserve}
+
+// NormalizeMetadataPolicy checks a policy name. Stripping is the default, so
+// it is returned as empty.
+func NormalizeMetadataPolicy(name string) (string, error) {
+	policy := strings.ToLower(strings.TrimSpace(name))
+	switch policy {
+	case "", MetadataStrip:
+		return "", nil
+	case MetadataSafe, MetadataPreserve:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unsupported metadata policy %q, expected one of %s", name, strings.Join(MetadataPolicies, ", "))
+}
+
+// EXIF tags handled specially
+const (
+	tagOrientation = 0x0112
+	tagExifIFD     = 0x8769
+)
+
+// safeTags are kept by MetadataSafe: Artist, Copyright and DateTime in IFD0,
+// and DateTimeOriginal, DateTimeDigitized and their time zone offsets in the Exif IFD
+var safeTags = map[uint16]bool{
+	0x013B: true, 0x8298: true, 0x0132: true,
+	0x9003: true, 0x9004: true, 0x9010: true, 0x9011: true, 0x9012: true,
+}
+
+// droppedTags are never copied: location (the GPS IFD), pointers into data
+// that is not copied (Interop IFD, sub-IFDs, strips, tiles, the thumbnail),
+// maker notes and XMP, which may hold location data of their own, and the
+// image size, which no longer matches the output
+var droppedTags = map[uint16]bool{
+	0x8825: true,               // GPS IFD
+	0xA005: true, 0x014A: true, // Interop IFD, sub-IFDs
+	0x0111: true, 0x0117: true, 0x0144: true, 0x0145: true, // strips and tiles
+	0x0201: true, 0x0202: true, // thumbnail
+	0x927C: true, 0x02BC: true, // maker notes, XMP
+	0x0100: true, 0x0101: true, 0xA002: true, 0xA003: true, // image size
+}
+
+// typeSizes are the sizes in bytes of the TIFF field types
+var typeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// Metadata is the EXIF data of an image
+type Metadata struct {
+	// Orientation is the EXIF orientation (1-8); 0 when the image has none
+	Orientation int
+
+	order byteOrder
+	ifd0  []tiffEntry
+	exif  []tiffEntry
+}
+
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// ReadMetadata reads the EXIF data of a JPEG, PNG or WebP file. Missing or
+// malformed EXIF data yields empty metadata; it never fails the image.
+func ReadMetadata(data []byte, format string) *Metadata {
+	m := &Metadata{}
+	var block []byte
+	switch format {
+	case "jpeg":
+		block = jpegEXIF(data)
+	case "png":
+		block = pngEXIF(data)
+	case "webp":
+		block, _ = webp.GetMetadata(data, "EXIF")
+	}
+	// Some writers keep the JPEG identifier in front of PNG and WebP EXIF data
+	block = bytes.TrimPrefix(block, []byte("Exif\x00\x00"))
+	if len(block) >= 8 {
+		m.parse(block)
+	}
+	return m
+}
+
+// jpegEXIF returns the payload of the APP1 Exif segment
+func jpegEXIF(data []byte) []byte {
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // image data follows
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil
+		}
+		if segment := data[i+4 : end]; marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		i = end
+	}
+	return nil
+}
+
+// pngEXIF returns the data of the eXIf chunk
+func pngEXIF(data []byte) []byte {
+	for i := 8; i+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if end > len(data) {
+			return nil
+		}
+		if string(data[i+4:i+8]) == "eXIf" {
+			return data[i+8 : i+8+length]
+		}
+		i = end
+	}
+	return nil
+}
+
+// parse reads IFD0 and the Exif IFD of a TIFF structure
+func (m *Metadata) parse(block []byte) {
+	switch string(block[:4]) {
+	case "II*\x00":
+		m.order = binary.LittleEndian
+	case "MM\x00*":
+		m.order = binary.BigEndian
+	default:
+		return
+	}
+	m.ifd0 = m.readIFD(block, m.order.Uint32(block[4:]))
+	for _, e := range m.ifd0 {
+		switch {
+		case e.tag == tagOrientation && e.typ == 3 && e.count == 1:
+			if o := int(m.order.Uint16(e.value)); o >= 1 && o <= 8 {
+				m.Orientation = o
+			}
+		case e.tag == tagExifIFD && (e.typ == 4 || e.typ == 13) && e.count == 1:
+			m.exif = m.readIFD(block, m.order.Uint32(e.value))
+		}
+	}
+}
+
+func (m *Metadata) readIFD(block []byte, offset uint32) []tiffEntry {
+	if uint64(offset)+2 > uint64(len(block)) {
+		return nil
+	}
+	n := uint32(m.order.Uint16(block[offset:]))
+	if uint64(offset)+2+12*uint64(n) > uint64(len(block)) {
+		return nil
+	}
+	entries := make([]tiffEntry, 0, n)
+	for i := uint32(0); i < n; i++ {
+		raw := block[offset+2+12*i:]
+		e := tiffEntry{tag: m.order.Uint16(raw), typ: m.order.Uint16(raw[2:]), count: m.order.Uint32(raw[4:])}
+		size, ok := typeSizes[e.typ]
+		if !ok && e.typ != 13 { // 13 is an IFD offset
+			continue
+		}
+		if e.typ == 13 {
+			size = 4
+		}
+		total := uint64(size) * uint64(e.count)
+		if total <= 4 {
+			e.value = raw[8 : 8+total]
+		} else {
+			at := uint64(m.order.Uint32(raw[8:]))
+			if at+total > uint64(len(block)) {
+				continue
+			}
+			e.value = block[at : at+total]
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// EXIF returns the EXIF block the output keeps under policy, or nil. When the
+// image has been turned upright, the orientation tag is dropped with it.
+func (m *Metadata) EXIF(policy string, oriented bool) []byte {
+	if policy == "" || policy == MetadataStrip || m.order == nil {
+		return nil
+	}
+	keep := func(e tiffEntry) bool {
+		switch {
+		case e.tag == tagOrientation:
+			return !oriented
+		case e.tag == tagExifIFD || droppedTags[e.tag] || e.typ == 13:
+			return false
+		case policy == MetadataSafe:
+			return safeTags[e.tag]
+		}
+		return policy == MetadataPreserve
+	}
+	ifd0, exif := filterEntries(m.ifd0, keep), filterEntries(m.exif, keep)
+	if len(ifd0) == 0 && len(exif) == 0 {
+		return nil
+	}
+
+	out := make([]byte, 8)
+	if m.order == binary.LittleEndian {
+		copy(out, "II*\x00")
+	} else {
+		copy(out, "MM\x00*")
+	}
+	m.order.PutUint32(out[4:], 8)
+	if len(exif) > 0 {
+		pointer := tiffEntry{tag: tagExifIFD, typ: 4, count: 1, value: make([]byte, 4)}
+		ifd0 = append(ifd0, pointer)
+		sort.Slice(ifd0, func(i, j int) bool { return ifd0[i].tag < ifd0[j].tag })
+		m.order.PutUint32(pointer.value, 8+ifdSize(ifd0))
+	}
+	out = m.appendIFD(out, ifd0)
+	if len(exif) > 0 {
+		out = m.appendIFD(out, exif)
+	}
+	return out
+}
+
+func filterEntries(entries []tiffEntry, keep func(tiffEntry) bool) []tiffEntry {
+	var kept []tiffEntry
+	for _, e := range entries {
+		if keep(e) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// ifdSize is the size of an IFD and the values stored after it
+func ifdSize(entries []tiffEntry) uint32 {
+	size := uint32(2 + 12*len(entries) + 4)
+	for _, e := range entries {
+		if len(e.value) > 4 {
+			size += uint32(len(e.value)+1) &^ 1 // values start on a word boundary
+		}
+	}
+	return size
+}
+
+// appendIFD writes an IFD, with no next IFD, followed by its values
+func (m *Metadata) appendIFD(out []byte, entries []tiffEntry) []byte {
+	valueAt := uint32(len(out) + 2 + 12*len(entries) + 4)
+	var values []byte
+	out = m.order.AppendUint16(out, uint16(len(entries)))
+	for _, e := range entries {
+		out = m.order.AppendUint16(out, e.tag)
+		out = m.order.AppendUint16(out, e.typ)
+		out = m.order.AppendUint32(out, e.count)
+		if len(e.value) <= 4 {
+			field := make([]byte, 4)
+			copy(field, e.value)
+			out = append(out, field...)
+			continue
+		}
+		out = m.order.AppendUint32(out, valueAt+uint32(len(values)))
+		values = append(values, e.value...)
+		if len(values)%2 == 1 {
+			values = append(values, 0)
+		}
+	}
+	out = m.order.AppendUint32(out, 0)
+	return append(out, values...)
+}
+
+// Orient turns img upright according to an EXIF orientation
+func Orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	}
+	return img
+}
+
+// EmbedEXIF adds an EXIF block to an encoded image. GIF has no place for it,
+// and a block too large for a JPEG segment is left out.
+func EmbedEXIF(data []byte, format string, exif []byte) ([]byte, error) {
+	if len(exif) == 0 {
+		return data, nil
+	}
+	switch format {
+	case "jpeg":
+		// The APP1 segment goes right after the start-of-image marker
+		length := 2 + 6 + len(exif)
+		if length > 0xFFFF || len(data) < 2 {
+			return data, nil
+		}
+		out := make([]byte, 0, len(data)+2+length)
+		out = append(out, data[:2]...)
+		out = append(out, 0xFF, 0xE1)
+		out = binary.BigEndian.AppendUint16(out, uint16(length))
+		out = append(out, "Exif\x00\x00"...)
+		out = append(out, exif...)
+		return append(out, data[2:]...), nil
+	case "png":
+		// The eXIf chunk goes after IHDR, which follows the 8-byte signature
+		const ihdrEnd = 8 + 12 + 13
+		if len(data) < ihdrEnd {
+			return nil, fmt.Errorf("png output is truncated")
+		}
+		chunk := binary.BigEndian.AppendUint32(nil, uint32(len(exif)))
+		chunk = append(chunk, "eXIf"...)
+		chunk = append(chunk, exif...)
+		chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+		out := make([]byte, 0, len(data)+len(chunk))
+		out = append(out, data[:ihdrEnd]...)
+		out = append(out, chunk...)
+		return append(out, data[ihdrEnd:]...), nil
+	case "webp":
+		return webp.SetMetadata(data, exif, "EXIF")
+	}
+	return data, nil
+}
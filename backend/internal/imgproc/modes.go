@@ -0,0 +1,203 @@
+package imgproc
+
+import (
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Resize modes: how the image is brought to a target width x height
+const (
+	ModeFit     = "fit"     // scale to fit inside, keeping the aspect ratio
+	ModeFill    = "fill"    // scale to cover, then crop the overflow at the anchor
+	ModePad     = "pad"     // fit, then letterbox with the background color
+	ModeStretch = "stretch" // scale to exactly width x height, distorting if needed
+)
+
+// ResizeModes are the modes ResizeSpec accepts
+var ResizeModes = []string{ModeFit, ModeFill, ModePad, ModeStretch}
+
+var anchors = map[string]imaging.Anchor{
+	"center":       imaging.Center,
+	"top-left":     imaging.TopLeft,
+	"top":          imaging.Top,
+	"top-right":    imaging.TopRight,
+	"left":         imaging.Left,
+	"right":        imaging.Right,
+	"bottom-left":  imaging.BottomLeft,
+	"bottom":       imaging.Bottom,
+	"bottom-right": imaging.BottomRight,
+}
+
+var filters = map[string]imaging.ResampleFilter{
+	"nearest":     imaging.NearestNeighbor,
+	"box":         imaging.Box,
+	"linear":      imaging.Linear,
+	"catmull-rom": imaging.CatmullRom,
+	"lanczos":     imaging.Lanczos,
+}
+
+// ResizeSpec selects how Resize scales an image. Empty fields take their
+// defaults: fit, center, white and lanczos. When only one side is given the
+// image is scaled proportionally, whatever the mode.
+type ResizeSpec struct {
+	Width  int
+	Height int
+	Mode   string
+	// Anchor is the part of the image fill keeps, or where pad places it:
+	// center, top, bottom, left, right, top-left, top-right, bottom-left or bottom-right
+	Anchor string
+	// Background is the pad color, as hex RGB or RGBA (e.g. "#fff", "#00000080"), or
+	// "transparent". Jpeg has no alpha, so transparency is flattened onto white there.
+	Background string
+	// Filter is the resampling filter: nearest, box, linear, catmull-rom or lanczos
+	Filter string
+	// ShrinkOnly never scales the image up
+	ShrinkOnly bool
+}
+
+// Validate checks the names in a spec
+func (s ResizeSpec) Validate() error {
+	if s.Mode != "" && !contains(ResizeModes, s.Mode) {
+		return fmt.Errorf("unsupported resize mode %q, expected one of %s", s.Mode, strings.Join(ResizeModes, ", "))
+	}
+	if _, ok := anchors[s.Anchor]; s.Anchor != "" && !ok {
+		return fmt.Errorf("unsupported anchor %q, expected one of %s", s.Anchor, strings.Join(names(anchors), ", "))
+	}
+	if _, ok := filters[s.Filter]; s.Filter != "" && !ok {
+		return fmt.Errorf("unsupported filter %q, expected one of %s", s.Filter, strings.Join(names(filters), ", "))
+	}
+	if _, err := parseColor(s.Background); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Resize scales img to the target of spec, which must be valid
+func Resize(img image.Image, spec ResizeSpec) *image.NRGBA {
+	filter, ok := filters[spec.Filter]
+	if !ok {
+		filter = imaging.Lanczos
+	}
+	anchor := anchors[spec.Anchor] // center by default
+	srcW, srcH := img.Bounds().Dx(), img.Bounds().Dy()
+	w, h := spec.Width, spec.Height
+	if w <= 0 && h <= 0 {
+		return imaging.Clone(img)
+	}
+
+	mode := spec.Mode
+	if w <= 0 || h <= 0 {
+		mode = ModeFit
+	}
+	switch mode {
+	case ModeFill:
+		scale := math.Max(float64(w)/float64(srcW), float64(h)/float64(srcH))
+		if spec.ShrinkOnly && scale > 1 {
+			// Crop what fits of the target at the original size
+			return imaging.CropAnchor(img, min(w, srcW), min(h, srcH), anchor)
+		}
+		return imaging.Fill(img, w, h, anchor, filter)
+	case ModeStretch:
+		if spec.ShrinkOnly {
+			w, h = min(w, srcW), min(h, srcH)
+		}
+		return imaging.Resize(img, w, h, filter)
+	case ModePad:
+		fitted := fit(img, w, h, spec.ShrinkOnly, filter)
+		bg, _ := parseColor(spec.Background)
+		canvas := imaging.New(w, h, bg)
+		return imaging.Overlay(canvas, fitted, anchorPoint(w, h, fitted.Bounds().Dx(), fitted.Bounds().Dy(), anchor), 1)
+	}
+	return fit(img, w, h, spec.ShrinkOnly, filter)
+}
+
+// fit scales img to fit inside w x h, keeping its aspect ratio; a side of 0 is unbounded
+func fit(img image.Image, w, h int, shrinkOnly bool, filter imaging.ResampleFilter) *image.NRGBA {
+	srcW, srcH := img.Bounds().Dx(), img.Bounds().Dy()
+	scale := math.Inf(1)
+	if w > 0 {
+		scale = float64(w) / float64(srcW)
+	}
+	if h > 0 {
+		scale = math.Min(scale, float64(h)/float64(srcH))
+	}
+	if shrinkOnly && scale >= 1 {
+		return imaging.Clone(img)
+	}
+	fitW := max(1, int(math.Round(float64(srcW)*scale)))
+	fitH := max(1, int(math.Round(float64(srcH)*scale)))
+	return imaging.Resize(img, fitW, fitH, filter)
+}
+
+// anchorPoint is where an imgW x imgH image goes inside w x h at anchor
+func anchorPoint(w, h, imgW, imgH int, anchor imaging.Anchor) image.Point {
+	x, y := (w-imgW)/2, (h-imgH)/2
+	switch anchor {
+	case imaging.TopLeft, imaging.Left, imaging.BottomLeft:
+		x = 0
+	case imaging.TopRight, imaging.Right, imaging.BottomRight:
+		x = w - imgW
+	}
+	switch anchor {
+	case imaging.TopLeft, imaging.Top, imaging.TopRight:
+		y = 0
+	case imaging.BottomLeft, imaging.Bottom, imaging.BottomRight:
+		y = h - imgH
+	}
+	return image.Pt(x, y)
+}
+
+// parseColor reads a hex color with an optional leading "#": RGB, RGBA,
+// RRGGBB or RRGGBBAA. Empty is white.
+func parseColor(raw string) (color.NRGBA, error) {
+	s := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(raw)), "#")
+	switch s {
+	case "":
+		return color.NRGBA{255, 255, 255, 255}, nil
+	case "transparent":
+		return color.NRGBA{}, nil
+	}
+	if len(s) == 3 || len(s) == 4 {
+		// Short form: every digit is doubled
+		var long strings.Builder
+		for _, c := range s {
+			long.WriteRune(c)
+			long.WriteRune(c)
+		}
+		s = long.String()
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil || (len(b) != 3 && len(b) != 4) {
+		return color.NRGBA{}, fmt.Errorf("invalid background color %q, expected hex such as #ffffff", raw)
+	}
+	c := color.NRGBA{R: b[0], G: b[1], B: b[2], A: 255}
+	if len(b) == 4 {
+		c.A = b[3]
+	}
+	return c, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func names[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
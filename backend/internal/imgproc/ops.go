@@ -0,0 +1,49 @@
+package imgproc
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// CropToAspect crops the largest centered region with the aspect ratio w:h
+func CropToAspect(img image.Image, w, h int) *image.NRGBA {
+	cropW, cropH := aspectSize(img.Bounds().Dx(), img.Bounds().Dy(), w, h)
+	return imaging.CropCenter(img, cropW, cropH)
+}
+
+// Crop cuts out rect, given relative to the top-left corner of img
+func Crop(img image.Image, rect image.Rectangle) *image.NRGBA {
+	return imaging.Crop(img, rect.Add(img.Bounds().Min))
+}
+
+// Watermark draws text in the bottom-right corner, scaled to a fifth of the
+// image width, at the given opacity (0-1)
+func Watermark(img image.Image, text string, opacity float64) *image.NRGBA {
+	face := basicfont.Face7x13
+	metrics := face.Metrics()
+	width := font.MeasureString(face, text).Ceil()
+	height := metrics.Height.Ceil()
+
+	// White text with a dark outline stays readable on any background
+	label := image.NewNRGBA(image.Rect(0, 0, width+2, height+2))
+	baseline := metrics.Ascent.Ceil() + 1
+	for _, offset := range []image.Point{{0, 1}, {2, 1}, {1, 0}, {1, 2}} {
+		d := &font.Drawer{Dst: label, Src: image.NewUniform(color.Black), Face: face, Dot: fixed.P(offset.X, baseline+offset.Y-1)}
+		d.DrawString(text)
+	}
+	d := &font.Drawer{Dst: label, Src: image.NewUniform(color.White), Face: face, Dot: fixed.P(1, baseline)}
+	d.DrawString(text)
+
+	b := img.Bounds()
+	if target := b.Dx() / 5; target > label.Bounds().Dx() {
+		label = imaging.Resize(label, target, 0, imaging.Linear)
+	}
+	margin := b.Dx() / 50
+	pos := image.Pt(b.Dx()-label.Bounds().Dx()-margin, b.Dy()-label.Bounds().Dy()-margin)
+	return imaging.Overlay(img, label, pos, opacity)
+}
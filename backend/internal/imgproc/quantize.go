@@ -0,0 +1,111 @@
+package imgproc
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// The palette is chosen from a sample of at most this many pixels
+const maxQuantizeSamples = 1 << 16
+
+// medianCut is a draw.Quantizer that builds a palette by median cut: the
+// sampled colors are split along their widest channel until there is one
+// group per palette entry, and each group contributes its average color.
+type medianCut struct{}
+
+func (medianCut) Quantize(p color.Palette, m image.Image) color.Palette {
+	n := cap(p) - len(p)
+	if n <= 0 {
+		return p
+	}
+	type box struct {
+		pixels  []color.RGBA
+		channel int
+		spread  int
+	}
+	newBox := func(pixels []color.RGBA) box {
+		channel, spread := widestChannel(pixels)
+		return box{pixels, channel, spread}
+	}
+	boxes := []box{newBox(samplePixels(m))}
+	for len(boxes) < n {
+		// Split the box with the widest range in any channel
+		widest := 0
+		for i := range boxes {
+			if boxes[i].spread > boxes[widest].spread {
+				widest = i
+			}
+		}
+		if boxes[widest].spread == 0 {
+			break // every box holds a single color
+		}
+		pixels, channel := boxes[widest].pixels, boxes[widest].channel
+		sort.Slice(pixels, func(i, j int) bool { return channelOf(pixels[i], channel) < channelOf(pixels[j], channel) })
+		half := len(pixels) / 2
+		boxes[widest] = newBox(pixels[:half])
+		boxes = append(boxes, newBox(pixels[half:]))
+	}
+	for _, b := range boxes {
+		if len(b.pixels) > 0 {
+			p = append(p, average(b.pixels))
+		}
+	}
+	return p
+}
+
+// samplePixels returns the colors of m on a grid fine enough for maxQuantizeSamples
+func samplePixels(m image.Image) []color.RGBA {
+	b := m.Bounds()
+	step := max(1, int(math.Ceil(math.Sqrt(float64(b.Dx()*b.Dy())/maxQuantizeSamples))))
+	var pixels []color.RGBA
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			pixels = append(pixels, color.RGBAModel.Convert(m.At(x, y)).(color.RGBA))
+		}
+	}
+	return pixels
+}
+
+func widestChannel(box []color.RGBA) (int, int) {
+	if len(box) < 2 {
+		return 0, 0
+	}
+	channel, spread := 0, 0
+	for c := 0; c < 4; c++ {
+		lo, hi := 255, 0
+		for _, px := range box {
+			v := channelOf(px, c)
+			lo, hi = min(lo, v), max(hi, v)
+		}
+		if hi-lo > spread {
+			channel, spread = c, hi-lo
+		}
+	}
+	return channel, spread
+}
+
+func channelOf(c color.RGBA, channel int) int {
+	switch channel {
+	case 0:
+		return int(c.R)
+	case 1:
+		return int(c.G)
+	case 2:
+		return int(c.B)
+	}
+	return int(c.A)
+}
+
+func average(box []color.RGBA) color.RGBA {
+	var r, g, b, a int
+	for _, px := range box {
+		r += int(px.R)
+		g += int(px.G)
+		b += int(px.B)
+		a += int(px.A)
+	}
+	n := len(box)
+	return color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), uint8(a / n)}
+}
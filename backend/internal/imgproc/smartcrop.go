@@ -0,0 +1,185 @@
+package imgproc
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// Saliency is scored on a copy scaled down to at most this many pixels per side
+const analysisSize = 256
+
+// Weights of the crop window score. The center bias is small; it only settles
+// windows that are about equally busy, e.g. on a plain background.
+const (
+	energyWeight  = 0.7
+	entropyWeight = 0.3
+	centerBias    = 0.1
+	entropyBins   = 16
+)
+
+// SmartCrop returns the largest window of img with the aspect ratio w:h,
+// relative to the top-left corner of img. The window is placed where the
+// image has the most detail, scored by edge energy and luminance entropy.
+// With a focal point (also relative to the top-left corner) the window is
+// centered on it instead, as far as the image bounds allow.
+func SmartCrop(img image.Image, w, h int, focus *image.Point) image.Rectangle {
+	b := img.Bounds()
+	cropW, cropH := aspectSize(b.Dx(), b.Dy(), w, h)
+
+	var x, y int
+	if focus != nil {
+		x, y = focus.X-cropW/2, focus.Y-cropH/2
+	} else {
+		x, y = salientWindow(img, cropW, cropH)
+	}
+	x = clamp(x, 0, b.Dx()-cropW)
+	y = clamp(y, 0, b.Dy()-cropH)
+	return image.Rect(x, y, x+cropW, y+cropH)
+}
+
+// aspectSize is the largest width x height with the ratio w:h that fits imgW x imgH
+func aspectSize(imgW, imgH, w, h int) (int, int) {
+	cropW, cropH := imgW, imgW*h/w
+	if cropH > imgH {
+		cropW, cropH = imgH*w/h, imgH
+	}
+	if cropW < 1 {
+		cropW = 1
+	}
+	if cropH < 1 {
+		cropH = 1
+	}
+	return cropW, cropH
+}
+
+// salientWindow returns the top-left corner of the best cropW x cropH window
+func salientWindow(img image.Image, cropW, cropH int) (int, int) {
+	b := img.Bounds()
+	small := imaging.Clone(img)
+	if b.Dx() > analysisSize || b.Dy() > analysisSize {
+		small = imaging.Fit(img, analysisSize, analysisSize, imaging.Box)
+	}
+	sw, sh := small.Bounds().Dx(), small.Bounds().Dy()
+	scale := float64(b.Dx()) / float64(sw)
+	winW := clamp(int(math.Round(float64(cropW)/scale)), 1, sw)
+	winH := clamp(int(math.Round(float64(cropH)/scale)), 1, sh)
+
+	lum := luminance(small)
+	energy := newIntegral(sw, sh)
+	hist := make([]*integral, entropyBins)
+	for i := range hist {
+		hist[i] = newIntegral(sw, sh)
+	}
+	for py := 0; py < sh; py++ {
+		for px := 0; px < sw; px++ {
+			// Central differences, one-sided at the border
+			dx := lum[py*sw+min(px+1, sw-1)] - lum[py*sw+max(px-1, 0)]
+			dy := lum[min(py+1, sh-1)*sw+px] - lum[max(py-1, 0)*sw+px]
+			energy.set(px, py, abs(dx)+abs(dy))
+			bin := lum[py*sw+px] * entropyBins / 256
+			for i := range hist {
+				v := 0
+				if i == bin {
+					v = 1
+				}
+				hist[i].set(px, py, v)
+			}
+		}
+	}
+
+	type candidate struct {
+		x, y    int
+		energy  float64
+		entropy float64
+	}
+	var candidates []candidate
+	maxEnergy := 0.0
+	area := float64(winW * winH)
+	for wy := 0; wy+winH <= sh; wy++ {
+		for wx := 0; wx+winW <= sw; wx++ {
+			c := candidate{x: wx, y: wy, energy: float64(energy.sum(wx, wy, winW, winH))}
+			for i := range hist {
+				if n := hist[i].sum(wx, wy, winW, winH); n > 0 {
+					p := float64(n) / area
+					c.entropy -= p * math.Log2(p)
+				}
+			}
+			if c.energy > maxEnergy {
+				maxEnergy = c.energy
+			}
+			candidates = append(candidates, c)
+		}
+	}
+
+	// Distances to the centered window, normalized by the furthest one
+	centerX, centerY := float64(sw-winW)/2, float64(sh-winH)/2
+	maxDist := math.Hypot(centerX, centerY)
+	best, bestScore := candidates[0], math.Inf(-1)
+	for _, c := range candidates {
+		score := entropyWeight * c.entropy / math.Log2(entropyBins)
+		if maxEnergy > 0 {
+			score += energyWeight * c.energy / maxEnergy
+		}
+		if maxDist > 0 {
+			score -= centerBias * math.Hypot(float64(c.x)-centerX, float64(c.y)-centerY) / maxDist
+		}
+		if score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+	return int(math.Round(float64(best.x) * scale)), int(math.Round(float64(best.y) * scale))
+}
+
+// luminance returns the Rec. 601 luma of every pixel, row by row (0-255)
+func luminance(img *image.NRGBA) []int {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	lum := make([]int, w*h)
+	for y := 0; y < h; y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < w; x++ {
+			r, g, b := int(row[x*4]), int(row[x*4+1]), int(row[x*4+2])
+			lum[y*w+x] = (299*r + 587*g + 114*b) / 1000
+		}
+	}
+	return lum
+}
+
+// integral is a summed-area table, for the sum over any window in constant time
+type integral struct {
+	w    int
+	sums []int
+}
+
+func newIntegral(w, h int) *integral {
+	return &integral{w: w + 1, sums: make([]int, (w+1)*(h+1))}
+}
+
+// set adds the value at (x, y); cells must be set in row-major order
+func (t *integral) set(x, y, v int) {
+	i := (y+1)*t.w + x + 1
+	t.sums[i] = v + t.sums[i-1] + t.sums[i-t.w] - t.sums[i-t.w-1]
+}
+
+func (t *integral) sum(x, y, w, h int) int {
+	at := func(x, y int) int { return t.sums[y*t.w+x] }
+	return at(x+w, y+h) - at(x, y+h) - at(x+w, y) + at(x, y)
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,145 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+func childrenKey(parentID string) string {
+	return fmt.Sprintf("job:%s:children", parentID)
+}
+
+// SetBatchSize records how many child jobs a batch expects, so progress is
+// not reported as complete while children are still being created
+func (jm *Manager) SetBatchSize(ctx context.Context, batchID string, total int) error {
+	err := jm.update(ctx, batchID, map[string]interface{}{"children_total": total})
+	if err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to set size of batch %s: %v", batchID, err)
+	}
+	return err
+}
+
+// addChild links a newly created job to its parent
+func (jm *Manager) addChild(ctx context.Context, parentID, childID string, ttl time.Duration) error {
+	return jm.store.PushList(ctx, childrenKey(parentID), childID, 0, ttl)
+}
+
+// Children returns the child jobs of a batch in creation order
+func (jm *Manager) Children(ctx context.Context, parentID string) ([]*Job, error) {
+	ids, err := jm.store.ListRange(ctx, childrenKey(parentID), 0, -1)
+	if err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to list children of %s: %v", parentID, err)
+		return nil, err
+	}
+
+	loaded, _, err := jm.loadJobs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	children := make([]*Job, 0, len(loaded))
+	for _, job := range loaded {
+		if job != nil { // skip expired
+			children = append(children, job)
+		}
+	}
+	return children, nil
+}
+
+// RefreshBatch recomputes a batch job's progress and status from its children
+func (jm *Manager) RefreshBatch(ctx context.Context, batchID string) error {
+	parent, err := jm.GetJob(ctx, batchID)
+	if err != nil {
+		return err
+	}
+	if parent.Children == nil || parent.Status.IsTerminal() {
+		return nil // not a batch, or already finished
+	}
+	children, err := jm.Children(ctx, batchID)
+	if err != nil {
+		return err
+	}
+
+	total := parent.Children.Total
+	if total < len(children) {
+		total = len(children)
+	}
+	summary := ChildSummary{Total: total}
+	progressSum := 0
+	for _, child := range children {
+		switch child.Status {
+		case StatusScheduled:
+			summary.Scheduled++
+		case StatusQueued:
+			summary.Queued++
+		case StatusRunning:
+			summary.Running++
+		case StatusSucceeded:
+			summary.Succeeded++
+		case StatusFailed:
+			summary.Failed++
+		case StatusCancelled:
+			summary.Cancelled++
+		}
+		if child.Status.IsTerminal() {
+			progressSum += 100
+		} else {
+			progressSum += child.Progress
+		}
+	}
+
+	fields := map[string]interface{}{
+		"children_scheduled": summary.Scheduled,
+		"children_queued":    summary.Queued,
+		"children_running":   summary.Running,
+		"children_succeeded": summary.Succeeded,
+		"children_failed":    summary.Failed,
+		"children_cancelled": summary.Cancelled,
+	}
+	if total > 0 {
+		fields["progress"] = progressSum / total
+	}
+	waiting := parent.Status == StatusQueued || parent.Status == StatusScheduled
+	switch {
+	case waiting && summary.Scheduled+summary.Queued+summary.Cancelled < len(children):
+		fields["status"] = string(StatusRunning)
+		fields["started_at"] = formatTime(time.Now())
+	case parent.Status == StatusScheduled && summary.Scheduled == 0 && len(children) > 0:
+		// Every child has been released to the work queue
+		fields["status"] = string(StatusQueued)
+	}
+	if err := jm.update(ctx, batchID, fields); errors.Is(err, ErrJobFinished) {
+		return nil // cancelled concurrently
+	} else if err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to update batch %s: %v", batchID, err)
+		return err
+	}
+	if fields["status"] == string(StatusRunning) {
+		jm.RecordEvent(ctx, batchID, EventStarted, nil)
+	}
+
+	// Finish the batch once every expected child reached a terminal state
+	if total == 0 || summary.terminal() < total {
+		return nil
+	}
+	switch {
+	case summary.Succeeded == 0 && summary.Failed == 0:
+		err = jm.update(ctx, batchID, map[string]interface{}{
+			"status":      string(StatusCancelled),
+			"finished_at": formatTime(time.Now()),
+		})
+		if err == nil {
+			jm.RecordEvent(ctx, batchID, EventCancelled, nil)
+		}
+	case summary.Succeeded == 0:
+		err = jm.FailJob(ctx, batchID, ErrCodeProcessing, fmt.Sprintf("all %d images failed", summary.Failed))
+	default:
+		err = jm.SucceedJob(ctx, batchID, nil)
+	}
+	if errors.Is(err, ErrJobFinished) {
+		return nil // finished by a concurrent refresh
+	}
+	return err
+}
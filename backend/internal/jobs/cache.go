@@ -0,0 +1,126 @@
+package jobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"file-formatter-tools/internal/imgproc"
+)
+
+// minCachedLifetime keeps cache hits away from objects that are about to be reaped
+const minCachedLifetime = 5 * time.Minute
+
+// CachedResult is the output of a completed job, stored under the hash of its
+// input and options so identical requests can reuse it
+type CachedResult struct {
+	JobID       string    `json:"job_id"`
+	ObjectName  string    `json:"object_name"`
+	Format      string    `json:"format"`
+	Width       int       `json:"width,omitempty"`
+	Height      int       `json:"height,omitempty"`
+	Quality     int       `json:"quality,omitempty"`
+	RetainUntil time.Time `json:"retain_until"`
+}
+
+func resultCacheKey(cacheKey string) string {
+	return fmt.Sprintf("cache:result:%s", cacheKey)
+}
+
+// CacheKey identifies a resize of imageData with opts. Results are only shared
+// between requests of the same API key. Options that cannot change the output
+// are normalized, so e.g. maintainAspectRatio does not matter for a one-sided resize.
+func CacheKey(keyID string, imageData []byte, opts ResizeOptions) string {
+	if opts.Width == 0 || opts.Height == 0 {
+		opts.Mode = imgproc.ModeFit
+	}
+	// The mode replaces maintainAspectRatio
+	opts.Mode = opts.Spec().Mode
+	opts.MaintainAspect = false
+	if opts.Mode != imgproc.ModePad {
+		opts.Background = ""
+	}
+	if opts.Mode == imgproc.ModeFit || opts.Mode == imgproc.ModeStretch {
+		opts.Anchor = ""
+	}
+	if opts.MaxSizeKB < 0 {
+		opts.MaxSizeKB = 0
+	}
+	normalized, _ := json.Marshal(opts)
+
+	content := sha256.Sum256(imageData)
+	h := sha256.New()
+	h.Write([]byte(keyID))
+	h.Write([]byte{0})
+	h.Write(content[:])
+	h.Write(normalized)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CacheResult records the output of a succeeded job under its cache key, for
+// as long as the output object is kept
+func (jm *Manager) CacheResult(ctx context.Context, cacheKey, jobID string, output Output) error {
+	return jm.saveCachedResult(ctx, cacheKey, CachedResult{
+		JobID:       jobID,
+		ObjectName:  output.ObjectName,
+		Format:      output.Format,
+		Width:       output.Width,
+		Height:      output.Height,
+		Quality:     output.Quality,
+		RetainUntil: time.Now().Add(jm.resultRetention),
+	})
+}
+
+func (jm *Manager) saveCachedResult(ctx context.Context, cacheKey string, result CachedResult) error {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode cached result: %w", err)
+	}
+	if err := jm.store.Set(ctx, resultCacheKey(cacheKey), string(encoded), time.Until(result.RetainUntil)); err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to cache result of job %s: %v", result.JobID, err)
+		return err
+	}
+	return nil
+}
+
+// LookupResult returns the cached output for a cache key, or nil if there is none
+func (jm *Manager) LookupResult(ctx context.Context, cacheKey string) (*CachedResult, error) {
+	raw, ok, err := jm.store.Get(ctx, resultCacheKey(cacheKey))
+	if err != nil || !ok {
+		return nil, err
+	}
+	var result CachedResult
+	if err := json.Unmarshal([]byte(raw), &result); err != nil {
+		return nil, fmt.Errorf("failed to decode cached result: %w", err)
+	}
+	if time.Until(result.RetainUntil) < minCachedLifetime {
+		return nil, nil
+	}
+	return &result, nil
+}
+
+// ReuseResult completes a job with a cached output instead of processing it.
+// The shared output object is kept for a full result retention from now.
+func (jm *Manager) ReuseResult(ctx context.Context, jobID, cacheKey string, cached *CachedResult, output Output) error {
+	retainUntil := time.Now().Add(jm.resultRetention)
+	if err := jm.store.AddScored(ctx, objectExpiryKey, cached.ObjectName, float64(retainUntil.Unix()), true); err != nil {
+		return err
+	}
+	refreshed := *cached
+	refreshed.RetainUntil = retainUntil
+	_ = jm.saveCachedResult(ctx, cacheKey, refreshed)
+
+	if err := jm.update(ctx, jobID, map[string]interface{}{"cached_from": cached.JobID}); err != nil {
+		return err
+	}
+	jm.RecordEvent(ctx, jobID, EventReused, map[string]interface{}{"cached_from": cached.JobID, "object": cached.ObjectName})
+	if err := jm.SucceedJob(ctx, jobID, []Output{output}); err != nil {
+		return err
+	}
+	log.Printf("[INFO] [Jobs] Job %s reused the result of job %s", jobID, cached.JobID)
+	return nil
+}
@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// ScheduleJob holds the task of a scheduled job (see Spec.RunAt) on the delay
+// queue until at. The encoded task is kept on the job so Cancel can withdraw it.
+func (jm *Manager) ScheduleJob(ctx context.Context, task Task, at time.Time) error {
+	payload, err := jm.encodeTask(&task)
+	if err != nil {
+		return err
+	}
+	// Record the task first, so a job on the delay queue can always be withdrawn
+	if err := jm.store.SetJobFields(ctx, task.JobID, map[string]interface{}{"scheduled_task": string(payload)}, 0); err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to schedule job %s: %v", task.JobID, err)
+		return err
+	}
+	if err := jm.store.AddScored(ctx, delayedKey, string(payload), float64(at.UnixMilli()), false); err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to schedule job %s: %v", task.JobID, err)
+		return err
+	}
+	log.Printf("[INFO] [Jobs] Scheduled job %s to run at %s", task.JobID, formatTime(at))
+	return nil
+}
+
+// unschedule removes a cancelled job's task from the delay queue and releases
+// its input right away instead of at the end of its retention
+func (jm *Manager) unschedule(ctx context.Context, payload string) {
+	removed, err := jm.store.RemoveScored(ctx, delayedKey, payload)
+	if err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to remove scheduled task: %v", err)
+		return
+	}
+	if !removed {
+		return // already promoted, the worker skips it
+	}
+	var task Task
+	if err := json.Unmarshal([]byte(payload), &task); err == nil && task.InputObject != "" {
+		_ = jm.ScheduleDeletion(ctx, task.InputObject, time.Now())
+	}
+}
@@ -0,0 +1,160 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Event types in a job's history
+const (
+	EventCreated        = "created"
+	EventStarted        = "started"
+	EventProgress       = "progress"
+	EventRetried        = "retried"
+	EventOutputUploaded = "output_uploaded"
+	EventReused         = "reused"
+	EventSucceeded      = "succeeded"
+	EventFailed         = "failed"
+	EventCancelled      = "cancelled"
+	EventExtended       = "extended"
+	EventDownloaded     = "downloaded"
+	EventExpired        = "expired"
+	EventDeleted        = "deleted"
+)
+
+// ErrInvalidCursor is returned for an `after` that is not an event ID
+var ErrInvalidCursor = errors.New("invalid event cursor")
+
+// ActorSystem is the actor of events not caused by an API request, e.g. a
+// worker processing the job or the retention reaper
+const ActorSystem = "system"
+
+// maxJobEvents bounds the history of a single job
+const maxJobEvents = 1000
+
+// objectOwnerKey maps output objects to the job that produced them, so their
+// expiry can be recorded in that job's history
+const objectOwnerKey = "objects:owner"
+
+func eventsKey(jobID string) string {
+	return fmt.Sprintf("job:%s:events", jobID)
+}
+
+// Event is an entry of a job's append-only history
+type Event struct {
+	ID      string                 `json:"id"`
+	Type    string                 `json:"type"`
+	Actor   string                 `json:"actor"`
+	At      time.Time              `json:"at"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+type actorKey struct{}
+
+// WithActor returns a context whose job events are attributed to an API key ID
+func WithActor(ctx context.Context, keyID string) context.Context {
+	return context.WithValue(ctx, actorKey{}, keyID)
+}
+
+func actorFrom(ctx context.Context) string {
+	if keyID, ok := ctx.Value(actorKey{}).(string); ok && keyID != "" {
+		return keyID
+	}
+	return ActorSystem
+}
+
+// RecordEvent appends an event to a job's history. A failure is only logged:
+// the history never fails the operation it describes. The history is kept
+// for the maximum retention after its last event, so it outlives the job
+// record and its outputs.
+func (jm *Manager) RecordEvent(ctx context.Context, jobID, eventType string, details map[string]interface{}) {
+	values := map[string]string{
+		"type":  eventType,
+		"actor": actorFrom(ctx),
+		"at":    formatTime(time.Now()),
+	}
+	if len(details) > 0 {
+		encoded, err := json.Marshal(details)
+		if err != nil {
+			log.Printf("[WARN] [Jobs] Failed to encode %s event of job %s: %v", eventType, jobID, err)
+			return
+		}
+		values["details"] = string(encoded)
+	}
+	if _, err := jm.store.AppendStream(ctx, eventsKey(jobID), values, maxJobEvents, jm.maxRetention); err != nil {
+		log.Printf("[WARN] [Jobs] Failed to record %s event of job %s: %v", eventType, jobID, err)
+	}
+}
+
+// Events returns up to limit events of a job after the event ID `after`
+// ("" for the first), oldest first
+func (jm *Manager) Events(ctx context.Context, jobID, after string, limit int64) ([]Event, error) {
+	if after != "" {
+		if _, _, err := parseStreamID(after); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	entries, err := jm.store.ReadStream(ctx, eventsKey(jobID), after, limit)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(entries))
+	for _, entry := range entries {
+		event := Event{ID: entry.ID, Type: entry.Values["type"], Actor: entry.Values["actor"]}
+		if at := parseTime(entry.Values["at"]); at != nil {
+			event.At = *at
+		}
+		if raw := entry.Values["details"]; raw != "" {
+			if err := json.Unmarshal([]byte(raw), &event.Details); err != nil {
+				log.Printf("[WARN] [Jobs] Malformed details in event %s of job %s: %v", entry.ID, jobID, err)
+			}
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Owner returns the API key ID that created a job. Once the record has
+// expired it is read from the "created" event, as the history outlives it.
+func (jm *Manager) Owner(ctx context.Context, jobID string) (string, error) {
+	job, err := jm.GetJob(ctx, jobID)
+	if err == nil {
+		return job.KeyID, nil
+	}
+	if !errors.Is(err, ErrJobNotFound) {
+		return "", err
+	}
+	events, err := jm.Events(ctx, jobID, "", 1)
+	if err != nil {
+		return "", err
+	}
+	if len(events) == 0 || events[0].Type != EventCreated {
+		return "", ErrJobNotFound
+	}
+	keyID, _ := events[0].Details["api_key_id"].(string)
+	return keyID, nil
+}
+
+// OutputExpired records the deletion of an output object at the end of its
+// retention in the history of the job that produced it
+func (jm *Manager) OutputExpired(ctx context.Context, objectName string) {
+	jobID, ok, err := jm.store.HashGet(ctx, objectOwnerKey, objectName)
+	if err != nil || !ok {
+		return // not an output, e.g. a leftover input
+	}
+	jm.RecordEvent(ctx, jobID, EventExpired, map[string]interface{}{"object": objectName})
+	_, _ = jm.store.HashDelete(ctx, objectOwnerKey, objectName)
+}
+
+// OutputDeleted records that an output object was deleted before its
+// retention ended, e.g. because the job was cancelled, and takes it off the
+// retention schedule
+func (jm *Manager) OutputDeleted(ctx context.Context, jobID, objectName string) {
+	_, _ = jm.store.RemoveScored(ctx, objectExpiryKey, objectName)
+	_, _ = jm.store.HashDelete(ctx, objectOwnerKey, objectName)
+	jm.RecordEvent(ctx, jobID, EventDeleted, map[string]interface{}{"object": objectName})
+}
@@ -0,0 +1,36 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// idReservationTTL is how long a used job ID stays reserved, well beyond the
+// lifetime of any job record
+const idReservationTTL = 7 * 24 * time.Hour
+
+var errIDTaken = errors.New("job ID already in use")
+
+// NewID returns a UUIDv7: unique across replicas and sortable by creation time.
+// It is used for job IDs and for S3 object keys.
+func NewID() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// reserveID claims a job ID with SETNX so it can never be handed out twice
+func (jm *Manager) reserveID(ctx context.Context) (string, error) {
+	for i := 0; i < 3; i++ {
+		id := NewID()
+		_, ok, err := jm.store.SetIfAbsent(ctx, "jobs:ids:"+id, "1", idReservationTTL)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return id, nil
+		}
+	}
+	return "", errIDTaken
+}
@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// idempotencyPendingTTL bounds how long a request that never finished (e.g. a
+// crashed replica) blocks retries with the same key
+const idempotencyPendingTTL = 5 * time.Minute
+
+// IdempotentResponse is what is stored under an Idempotency-Key: the request
+// fingerprint and, once the first request finished, its response
+type IdempotentResponse struct {
+	Fingerprint string `json:"fingerprint"`
+	Pending     bool   `json:"pending,omitempty"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+func idempotencyKey(keyID, key string) string {
+	return fmt.Sprintf("idempotency:%s:%s", keyID, key)
+}
+
+// ReserveIdempotencyKey claims an idempotency key for a request. If the key
+// was already used, the stored record is returned instead and nothing changes.
+func (jm *Manager) ReserveIdempotencyKey(ctx context.Context, keyID, key, fingerprint string) (*IdempotentResponse, error) {
+	pending, err := json.Marshal(IdempotentResponse{Fingerprint: fingerprint, Pending: true})
+	if err != nil {
+		return nil, err
+	}
+	raw, reserved, err := jm.store.SetIfAbsent(ctx, idempotencyKey(keyID, key), string(pending), idempotencyPendingTTL)
+	if err != nil {
+		return nil, err
+	}
+	if reserved {
+		return nil, nil
+	}
+	var existing IdempotentResponse
+	if err := json.Unmarshal([]byte(raw), &existing); err != nil {
+		return nil, fmt.Errorf("failed to decode idempotency record: %w", err)
+	}
+	return &existing, nil
+}
+
+// SaveIdempotentResponse stores the response of the first request so retries
+// within ttl replay it
+func (jm *Manager) SaveIdempotentResponse(ctx context.Context, keyID, key string, resp IdempotentResponse, ttl time.Duration) error {
+	encoded, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return jm.store.Set(ctx, idempotencyKey(keyID, key), string(encoded), ttl)
+}
+
+// ReleaseIdempotencyKey forgets a key whose request failed, so it can be retried
+func (jm *Manager) ReleaseIdempotencyKey(ctx context.Context, keyID, key string) error {
+	return jm.store.Delete(ctx, idempotencyKey(keyID, key))
+}
@@ -0,0 +1,168 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Jobs are indexed in sorted sets with a constant score, so members are ordered
+// lexicographically by job ID. UUIDv7 IDs start with the creation time in
+// milliseconds, which makes that order chronological and lets time ranges and
+// cursors be expressed as lex bounds.
+const (
+	indexPrefix = "jobs:index:"
+	indexAll    = indexPrefix + "all"
+)
+
+func statusIndex(status Status) string { return indexPrefix + "status:" + string(status) }
+func typeIndex(jobType string) string  { return indexPrefix + "type:" + jobType }
+func keyIndex(keyID string) string     { return indexPrefix + "key:" + keyID }
+
+// indexesFor lists the indexes a new job is added to
+func indexesFor(spec Spec, status Status) []string {
+	indexes := []string{indexAll, statusIndex(status)}
+	if spec.Type != "" {
+		indexes = append(indexes, typeIndex(spec.Type))
+	}
+	if spec.KeyID != "" {
+		indexes = append(indexes, keyIndex(spec.KeyID))
+	}
+	return indexes
+}
+
+// Filter selects jobs for List; zero values match everything
+type Filter struct {
+	Status    Status
+	Type      string
+	KeyID     string
+	From      time.Time // created at or after
+	To        time.Time // created before
+	Cursor    string    // job ID of the last item of the previous page
+	Limit     int
+	Ascending bool // oldest first; default is newest first
+}
+
+// List returns a page of jobs matching the filter and the cursor for the next
+// page, which is empty when there are no more results
+func (jm *Manager) List(ctx context.Context, f Filter) ([]*Job, string, error) {
+	if f.Limit <= 0 {
+		f.Limit = 50
+	}
+
+	indexes := []string{}
+	if f.Status != "" {
+		indexes = append(indexes, statusIndex(f.Status))
+	}
+	if f.Type != "" {
+		indexes = append(indexes, typeIndex(f.Type))
+	}
+	if f.KeyID != "" {
+		indexes = append(indexes, keyIndex(f.KeyID))
+	}
+
+	if len(indexes) == 0 {
+		indexes = []string{indexAll}
+	}
+
+	lower, upper := "-", "+"
+	if !f.From.IsZero() {
+		lower = "[" + idPrefix(f.From)
+	}
+	if !f.To.IsZero() {
+		upper = "(" + idPrefix(f.To)
+	}
+	if f.Cursor != "" {
+		if f.Ascending {
+			lower = "(" + f.Cursor
+		} else {
+			upper = "(" + f.Cursor
+		}
+	}
+
+	result := []*Job{}
+	for {
+		// Fetch one extra to know whether another page exists
+		want := f.Limit - len(result) + 1
+		ids, err := jm.store.RangeIndex(ctx, indexes, lower, upper, want, !f.Ascending)
+		if err != nil {
+			return nil, "", err
+		}
+
+		jobs, missing, err := jm.loadJobs(ctx, ids)
+		if err != nil {
+			return nil, "", err
+		}
+		jm.dropFromIndexes(ctx, append(indexes, indexAll), missing)
+
+		for i, job := range jobs {
+			if job != nil {
+				if len(result) == f.Limit {
+					return result, result[len(result)-1].ID, nil
+				}
+				result = append(result, job)
+			}
+			// Advance past this ID for the next round
+			if f.Ascending {
+				lower = "(" + ids[i]
+			} else {
+				upper = "(" + ids[i]
+			}
+		}
+		if len(ids) < want {
+			return result, "", nil
+		}
+		if len(result) == f.Limit {
+			return result, result[len(result)-1].ID, nil
+		}
+	}
+}
+
+// loadJobs fetches job records in one round trip; expired jobs are nil in the
+// result and their IDs are returned separately
+func (jm *Manager) loadJobs(ctx context.Context, ids []string) ([]*Job, []string, error) {
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+	records, err := jm.store.GetJobs(ctx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jobs := make([]*Job, len(ids))
+	missing := []string{}
+	for i, fields := range records {
+		if len(fields) == 0 {
+			missing = append(missing, ids[i])
+			continue
+		}
+		job, err := parseJob(ids[i], fields)
+		if err != nil {
+			return nil, nil, err
+		}
+		jobs[i] = job
+	}
+	return jobs, missing, nil
+}
+
+// dropFromIndexes lazily removes expired jobs from the indexes they were found in
+func (jm *Manager) dropFromIndexes(ctx context.Context, indexes []string, ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	_ = jm.store.RemoveFromIndexes(ctx, indexes, ids)
+}
+
+// TrimIndexes removes jobs created more than MaxRetention ago whose record
+// has expired from every index. Scheduled and extended jobs can outlive
+// MaxRetention and stay listed until their record goes. List also drops
+// expired IDs as it meets them, but only in the indexes it reads.
+func (jm *Manager) TrimIndexes(ctx context.Context) (int64, error) {
+	return jm.store.TrimIndexes(ctx, indexPrefix, idPrefix(time.Now().Add(-jm.maxRetention)))
+}
+
+// idPrefix is the leading part of a UUIDv7 created at t ("xxxxxxxx-xxxx")
+func idPrefix(t time.Time) string {
+	hex := fmt.Sprintf("%012x", t.UnixMilli())
+	return hex[:8] + "-" + hex[8:12]
+}
@@ -0,0 +1,117 @@
+package jobs
+
+import "time"
+
+// Status is the lifecycle state of a job
+type Status string
+
+const (
+	StatusScheduled Status = "scheduled"
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// IsTerminal reports whether the job will not change state any more
+func (s Status) IsTerminal() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCancelled
+}
+
+// Error codes stored on failed jobs
+const (
+	ErrCodeInvalidInput = "invalid_input"
+	ErrCodeProcessing   = "processing_failed"
+	ErrCodeStorage      = "storage_failed"
+	ErrCodeFetch        = "fetch_failed"
+	ErrCodeInternal     = "internal_error"
+)
+
+// Spec describes a job at creation time
+type Spec struct {
+	Type     string
+	ParentID string
+	KeyID    string
+	Priority string
+	Filename string
+
+	// ScheduleID links a batch to the recurring schedule that created it
+	ScheduleID string
+
+	// RunAt holds the job back until the given time; zero means run now
+	RunAt time.Time
+
+	// CallbackURL receives a signed webhook once the job finishes
+	CallbackURL string
+	Options     *ResizeOptions
+
+	// SourceURL is where the input image is fetched from, for /api/upload-from-url
+	SourceURL string
+}
+
+// Output is a processed file produced by a job
+type Output struct {
+	Name        string `json:"name,omitempty"` // pipeline output name
+	ObjectName  string `json:"object_name"`
+	DownloadURL string `json:"download_url"`
+	// TrackedURL is the API path that redirects to the output and records a
+	// downloaded event; fetching DownloadURL directly goes unrecorded
+	TrackedURL string `json:"tracked_url,omitempty"`
+	Format     string `json:"format"`
+
+	// What the image was written as, after fitting it into max_size_kb
+	Width   int `json:"width,omitempty"`
+	Height  int `json:"height,omitempty"`
+	Quality int `json:"quality,omitempty"` // of jpeg and webp
+
+	// When DownloadURL stops working
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Job is the record stored in the Redis hash job:<id>
+type Job struct {
+	ID            string         `json:"job_id"`
+	Type          string         `json:"type"`
+	ParentID      string         `json:"parent_id,omitempty"`
+	ScheduleID    string         `json:"schedule_id,omitempty"`
+	KeyID         string         `json:"api_key_id,omitempty"`
+	Status        Status         `json:"status"`
+	Progress      int            `json:"progress"`
+	Error         string         `json:"error,omitempty"`
+	ErrorCode     string         `json:"error_code,omitempty"`
+	Filename      string         `json:"filename,omitempty"`
+	SourceURL     string         `json:"source_url,omitempty"`
+	CallbackURL   string         `json:"callback_url,omitempty"`
+	Priority      string         `json:"priority,omitempty"`
+	Attempts      int            `json:"attempts,omitempty"`
+	LastError     string         `json:"last_error,omitempty"`
+	Options       *ResizeOptions `json:"options,omitempty"`
+	Outputs       []Output       `json:"outputs,omitempty"`
+	Children      *ChildSummary  `json:"children,omitempty"`
+	Steps         []StepStatus   `json:"steps,omitempty"`
+	CreatedAt     *time.Time     `json:"created_at,omitempty"`
+	StartedAt     *time.Time     `json:"started_at,omitempty"`
+	FinishedAt    *time.Time     `json:"finished_at,omitempty"`
+	RunAt         *time.Time     `json:"run_at,omitempty"`
+	NextAttemptAt *time.Time     `json:"next_attempt_at,omitempty"`
+	RetainUntil   *time.Time     `json:"retain_until,omitempty"`
+
+	// CachedFrom is the earlier job whose result was reused instead of processing again
+	CachedFrom string `json:"cached_from,omitempty"`
+}
+
+// ChildSummary counts the children of a batch job by status
+type ChildSummary struct {
+	Total     int `json:"total"`
+	Scheduled int `json:"scheduled"`
+	Queued    int `json:"queued"`
+	Running   int `json:"running"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Cancelled int `json:"cancelled"`
+}
+
+func (s ChildSummary) terminal() int {
+	return s.Succeeded + s.Failed + s.Cancelled
+}
@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrLeaseExpired is the cause recorded on a job whose worker stopped renewing its lease
+var ErrLeaseExpired = errors.New("worker lease expired")
+
+// RenewLease extends the worker's lease on a job. Returns false if the lease
+// was lost, i.e. it expired and the job has been handed to another worker.
+func (jm *Manager) RenewLease(ctx context.Context, jobID string) (bool, error) {
+	return jm.store.RenewLease(ctx, jobID, time.Now().Add(jm.leaseTTL))
+}
+
+// ReleaseLease ends the lease on a job once the worker is done with it
+func (jm *Manager) ReleaseLease(ctx context.Context, jobID string) error {
+	if err := jm.store.ReleaseLease(ctx, jobID); err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to release lease on job %s: %v", jobID, err)
+		return err
+	}
+	return nil
+}
+
+// RecoverExpiredLeases puts jobs whose worker disappeared back in the queue.
+// The lost attempt counts towards the retry policy; a job out of attempts is
+// dead-lettered and failed. Returns the number of jobs recovered.
+func (jm *Manager) RecoverExpiredLeases(ctx context.Context, limit int) (int, error) {
+	expired, err := jm.store.ExpireLeases(ctx, time.Now(), limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, payload := range expired {
+		var task Task
+		if err := json.Unmarshal([]byte(payload), &task); err != nil {
+			log.Printf("[ERROR] [Jobs] Skipping malformed leased task: %v", err)
+			continue
+		}
+		// The leased payload predates the worker's attempt counter
+		task.Attempt++
+		log.Printf("[WARN] [Jobs] Lease on job %s expired during attempt %d", task.JobID, task.Attempt)
+
+		retried, err := jm.RetryJob(ctx, task, ErrLeaseExpired)
+		if errors.Is(err, ErrJobFinished) || errors.Is(err, ErrJobNotFound) {
+			continue // finished or cancelled before the worker went away
+		}
+		if err != nil {
+			log.Printf("[ERROR] [Jobs] Could not requeue job %s: %v", task.JobID, err)
+			continue
+		}
+		if !retried {
+			_ = jm.AddDeadLetter(ctx, task, ErrLeaseExpired)
+			_ = jm.FailJob(ctx, task.JobID, ErrCodeInternal, ErrLeaseExpired.Error())
+		}
+		if task.BatchID != "" {
+			_ = jm.RefreshBatch(ctx, task.BatchID)
+		}
+	}
+	return len(expired), nil
+}
@@ -2,53 +2,350 @@ package jobs
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
+	"strconv"
 	"time"
 
-	"github.com/go-redis/redis/v8"
+	"file-formatter-tools/internal/config"
 )
 
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobFinished = errors.New("job already finished")
+)
+
+// Manager implements the job lifecycle on top of a JobStore
 type Manager struct {
-	rdb *redis.Client
+	store     JobStore
+	retry     RetryPolicy
+	scheduler scheduler
+
+	leaseTTL time.Duration
+
+	retention       time.Duration // job records
+	resultRetention time.Duration // output objects
+	maxRetention    time.Duration
+	maxLifetime     time.Duration // job records, counted from creation
+}
+
+func NewManager(store JobStore, cfg *config.Config) *Manager {
+	log.Printf("[INFO] [Jobs] Job manager initialized (store=%T)", store)
+	return &Manager{
+		store: store,
+		retry: RetryPolicy{
+			MaxAttempts: cfg.JobMaxAttempts,
+			BaseDelay:   cfg.JobRetryBaseDelay,
+			MaxDelay:    cfg.JobRetryMaxDelay,
+		},
+		scheduler:       newScheduler(cfg),
+		leaseTTL:        cfg.WorkerLeaseTTL,
+		retention:       cfg.JobRetention,
+		resultRetention: cfg.ResultRetention,
+		maxRetention:    cfg.MaxRetention,
+		maxLifetime:     cfg.MaxRetention + cfg.MaxScheduleDelay,
+	}
 }
 
-func NewManager(rdb *redis.Client) *Manager {
-	log.Printf("[INFO] [Jobs] Redis job manager initialized")
-	return &Manager{rdb: rdb}
+func jobKey(jobID string) string {
+	return fmt.Sprintf("job:%s", jobID)
 }
 
-func (jm *Manager) NewJob(ctx context.Context) (string, error) {
-	jobID := fmt.Sprintf("%d", time.Now().UnixNano())
-	if err := jm.rdb.Set(ctx, fmt.Sprintf("job:%s:progress", jobID), 0, 30*time.Minute).Err(); err != nil {
+// NewJob creates a queued job record and returns its ID
+func (jm *Manager) NewJob(ctx context.Context, spec Spec) (string, error) {
+	jobID, err := jm.reserveID(ctx)
+	if err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to reserve job ID: %v", err)
+		return "", err
+	}
+	status := StatusQueued
+	ttl := jm.retention
+	if !spec.RunAt.IsZero() {
+		// Keep the record until the job has run and its normal retention passed
+		status = StatusScheduled
+		ttl += time.Until(spec.RunAt)
+	}
+	fields := map[string]interface{}{
+		"type":       spec.Type,
+		"status":     string(status),
+		"progress":   0,
+		"filename":   spec.Filename,
+		"api_key_id": spec.KeyID,
+		"created_at": formatTime(time.Now()),
+	}
+	if spec.ParentID != "" {
+		fields["parent_id"] = spec.ParentID
+	}
+	if spec.ScheduleID != "" {
+		fields["schedule_id"] = spec.ScheduleID
+	}
+	if spec.CallbackURL != "" {
+		fields["callback_url"] = spec.CallbackURL
+	}
+	if spec.SourceURL != "" {
+		fields["source_url"] = spec.SourceURL
+	}
+	if spec.Priority != "" {
+		fields["priority"] = spec.Priority
+	}
+	if !spec.RunAt.IsZero() {
+		fields["run_at"] = formatTime(spec.RunAt)
+	}
+	if spec.Options != nil {
+		opts, err := json.Marshal(spec.Options)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode options: %w", err)
+		}
+		fields["options"] = string(opts)
+	}
+	if err := jm.store.CreateJob(ctx, jobID, fields, ttl, indexesFor(spec, status)); err != nil {
 		log.Printf("[ERROR] [Jobs] Failed to create new job: %v", err)
 		return "", err
 	}
-	log.Printf("[INFO] [Jobs] Created new job: %s", jobID)
+	if spec.ParentID != "" {
+		if err := jm.addChild(ctx, spec.ParentID, jobID, ttl); err != nil {
+			log.Printf("[ERROR] [Jobs] Failed to link job %s to parent %s: %v", jobID, spec.ParentID, err)
+			return "", err
+		}
+	}
+	details := map[string]interface{}{"type": spec.Type, "status": string(status)}
+	if spec.KeyID != "" {
+		details["api_key_id"] = spec.KeyID
+	}
+	if spec.ParentID != "" {
+		details["parent_id"] = spec.ParentID
+	}
+	if spec.ScheduleID != "" {
+		details["schedule_id"] = spec.ScheduleID
+	}
+	if !spec.RunAt.IsZero() {
+		details["run_at"] = formatTime(spec.RunAt)
+	}
+	if spec.SourceURL != "" {
+		details["source_url"] = spec.SourceURL
+	}
+	jm.RecordEvent(ctx, jobID, EventCreated, details)
+	log.Printf("[INFO] [Jobs] Created new %s job: %s", spec.Type, jobID)
 	return jobID, nil
 }
 
 func (jm *Manager) SetProgress(ctx context.Context, jobID string, progress int) error {
-	err := jm.rdb.Set(ctx, fmt.Sprintf("job:%s:progress", jobID), progress, 30*time.Minute).Err()
-	if err != nil {
+	err := jm.update(ctx, jobID, map[string]interface{}{"progress": progress})
+	if err != nil && !errors.Is(err, ErrJobFinished) {
 		log.Printf("[ERROR] [Jobs] Failed to set progress for job %s: %v", jobID, err)
 	}
+	if err == nil {
+		jm.RecordEvent(ctx, jobID, EventProgress, map[string]interface{}{"progress": progress})
+	}
 	return err
 }
 
-func (jm *Manager) GetProgress(jobID string) (int, error) {
-	ctx := context.Background()
-	val, err := jm.rdb.Get(ctx, fmt.Sprintf("job:%s:progress", jobID)).Int()
+// StartJob marks a job as picked up by a worker for the given attempt (1-based)
+func (jm *Manager) StartJob(ctx context.Context, jobID string, attempt int) error {
+	err := jm.update(ctx, jobID, map[string]interface{}{
+		"status":     string(StatusRunning),
+		"attempts":   attempt,
+		"started_at": formatTime(time.Now()),
+	})
 	if err != nil {
-		log.Printf("[ERROR] [Jobs] Failed to get progress for job %s: %v", jobID, err)
+		log.Printf("[ERROR] [Jobs] Failed to start job %s: %v", jobID, err)
+		return err
 	}
-	return val, err
+	jm.RecordEvent(ctx, jobID, EventStarted, map[string]interface{}{"attempt": attempt})
+	return nil
 }
 
-func (jm *Manager) CompleteJob(ctx context.Context, jobID string) error {
-	err := jm.rdb.Set(ctx, fmt.Sprintf("job:%s:progress", jobID), 100, 30*time.Minute).Err()
+// SucceedJob marks a job as finished and records its outputs
+func (jm *Manager) SucceedJob(ctx context.Context, jobID string, outputs []Output) error {
+	fields := map[string]interface{}{
+		"status":      string(StatusSucceeded),
+		"progress":    100,
+		"finished_at": formatTime(time.Now()),
+	}
+	if len(outputs) > 0 {
+		encoded, err := json.Marshal(outputs)
+		if err != nil {
+			return fmt.Errorf("failed to encode outputs: %w", err)
+		}
+		fields["outputs"] = string(encoded)
+		fields["retain_until"] = formatTime(time.Now().Add(jm.resultRetention))
+	}
+	err := jm.update(ctx, jobID, fields)
 	if err != nil {
 		log.Printf("[ERROR] [Jobs] Failed to complete job %s: %v", jobID, err)
+		return err
 	}
-	return err
+	jm.RecordEvent(ctx, jobID, EventSucceeded, map[string]interface{}{"outputs": len(outputs)})
+	return nil
+}
+
+// FailJob marks a job as failed with a machine-readable code and a message
+func (jm *Manager) FailJob(ctx context.Context, jobID, code, message string) error {
+	err := jm.update(ctx, jobID, map[string]interface{}{
+		"status":      string(StatusFailed),
+		"error":       message,
+		"error_code":  code,
+		"finished_at": formatTime(time.Now()),
+	})
+	if err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to mark job %s as failed: %v", jobID, err)
+		return err
+	}
+	jm.RecordEvent(ctx, jobID, EventFailed, map[string]interface{}{"error_code": code, "error": message})
+	return nil
+}
+
+// Cancel marks a job as cancelled; for a batch every unfinished child is
+// cancelled as well. Workers notice at their next step boundary, and a
+// scheduled job is taken off the delay queue.
+func (jm *Manager) Cancel(ctx context.Context, jobID string) error {
+	var scheduled string
+	if records, err := jm.store.GetJobs(ctx, []string{jobID}); err == nil {
+		scheduled = records[0]["scheduled_task"]
+	}
+	err := jm.update(ctx, jobID, map[string]interface{}{
+		"status":      string(StatusCancelled),
+		"finished_at": formatTime(time.Now()),
+	})
+	if err != nil {
+		return err
+	}
+	jm.RecordEvent(ctx, jobID, EventCancelled, nil)
+	log.Printf("[INFO] [Jobs] Cancelled job %s", jobID)
+	if scheduled != "" {
+		jm.unschedule(ctx, scheduled)
+	}
+
+	children, err := jm.Children(ctx, jobID)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if child.Status.IsTerminal() {
+			continue
+		}
+		if err := jm.Cancel(ctx, child.ID); err != nil && !errors.Is(err, ErrJobFinished) {
+			log.Printf("[ERROR] [Jobs] Failed to cancel child job %s: %v", child.ID, err)
+		}
+	}
+
+	// A single cancelled image still counts towards its batch
+	if job, err := jm.GetJob(ctx, jobID); err == nil && job.ParentID != "" {
+		_ = jm.RefreshBatch(ctx, job.ParentID)
+	}
+	return nil
+}
+
+// GetJob loads the full job record
+func (jm *Manager) GetJob(ctx context.Context, jobID string) (*Job, error) {
+	records, err := jm.store.GetJobs(ctx, []string{jobID})
+	if err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to get job %s: %v", jobID, err)
+		return nil, err
+	}
+	if len(records[0]) == 0 {
+		return nil, ErrJobNotFound
+	}
+	return parseJob(jobID, records[0])
+}
+
+// update writes fields to a live job hash, refreshes its TTL and notifies watchers.
+// Returns ErrJobFinished if the job already reached a terminal state.
+func (jm *Manager) update(ctx context.Context, jobID string, fields map[string]interface{}) error {
+	if err := jm.store.UpdateJob(ctx, jobID, fields, jm.retention); err != nil {
+		return err
+	}
+	jm.publish(ctx, jobID)
+
+	if status, ok := fields["status"].(string); ok && Status(status).IsTerminal() {
+		jm.enqueueWebhook(ctx, jobID)
+	}
+	return nil
+}
+
+func parseJob(jobID string, fields map[string]string) (*Job, error) {
+	job := &Job{
+		ID:          jobID,
+		Type:        fields["type"],
+		ParentID:    fields["parent_id"],
+		ScheduleID:  fields["schedule_id"],
+		KeyID:       fields["api_key_id"],
+		Status:      Status(fields["status"]),
+		Error:       fields["error"],
+		ErrorCode:   fields["error_code"],
+		Filename:    fields["filename"],
+		SourceURL:   fields["source_url"],
+		LastError:   fields["last_error"],
+		CallbackURL: fields["callback_url"],
+		Priority:    fields["priority"],
+		CachedFrom:  fields["cached_from"],
+	}
+	job.Progress, _ = strconv.Atoi(fields["progress"])
+	job.Attempts, _ = strconv.Atoi(fields["attempts"])
+	job.CreatedAt = parseTime(fields["created_at"])
+	job.StartedAt = parseTime(fields["started_at"])
+	job.FinishedAt = parseTime(fields["finished_at"])
+	job.RunAt = parseTime(fields["run_at"])
+	job.NextAttemptAt = parseTime(fields["next_attempt_at"])
+	job.RetainUntil = parseTime(fields["retain_until"])
+
+	if raw := fields["children_total"]; raw != "" {
+		job.Children = &ChildSummary{}
+		job.Children.Total, _ = strconv.Atoi(raw)
+		job.Children.Scheduled, _ = strconv.Atoi(fields["children_scheduled"])
+		job.Children.Queued, _ = strconv.Atoi(fields["children_queued"])
+		job.Children.Running, _ = strconv.Atoi(fields["children_running"])
+		job.Children.Succeeded, _ = strconv.Atoi(fields["children_succeeded"])
+		job.Children.Failed, _ = strconv.Atoi(fields["children_failed"])
+		job.Children.Cancelled, _ = strconv.Atoi(fields["children_cancelled"])
+	}
+	if raw := fields["options"]; raw != "" {
+		job.Options = &ResizeOptions{}
+		if err := json.Unmarshal([]byte(raw), job.Options); err != nil {
+			return nil, fmt.Errorf("failed to decode options of job %s: %w", jobID, err)
+		}
+	}
+	if raw := fields["steps"]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &job.Steps); err != nil {
+			return nil, fmt.Errorf("failed to decode steps of job %s: %w", jobID, err)
+		}
+	}
+	if raw := fields["outputs"]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &job.Outputs); err != nil {
+			return nil, fmt.Errorf("failed to decode outputs of job %s: %w", jobID, err)
+		}
+		for i := range job.Outputs {
+			job.Outputs[i].TrackedURL = trackedURL(jobID, i, job.Outputs[i].Name)
+		}
+	}
+	return job, nil
+}
+
+// trackedURL is the /api/jobs/:id/download path of an output, selected by
+// name if it has one and by index otherwise
+func trackedURL(jobID string, index int, name string) string {
+	selector := strconv.Itoa(index)
+	if name != "" {
+		selector = url.QueryEscape(name)
+	}
+	return fmt.Sprintf("/api/jobs/%s/download?output=%s", jobID, selector)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseTime returns nil for unset timestamps so they are omitted from JSON
+func parseTime(s string) *time.Time {
+	if s == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil
+	}
+	return &t
 }
@@ -0,0 +1,797 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired keys are purged; reads also check expiry
+const sweepInterval = time.Minute
+
+// MemoryStore keeps everything inside one process: jobs are lost on restart
+// and cannot be shared with other replicas. It mirrors the RedisStore data
+// model, including TTLs, so the rest of the package behaves the same on both.
+type MemoryStore struct {
+	mu        sync.Mutex
+	strs      map[string]string
+	hashes    map[string]map[string]string
+	lists     map[string][]string
+	zsets     map[string]map[string]float64
+	streams   map[string][]StreamEntry
+	expiry    map[string]time.Time
+	nextSweep time.Time
+
+	subs map[string]map[chan struct{}]bool
+
+	// Queue state, see the layout described in RedisStore
+	lanes     map[string][]string       // "<priority>:<tenant>" -> tasks, oldest first
+	rotations map[string][]string       // priority -> tenants with queued work
+	credits   map[string]map[string]int // priority -> tenant -> turns used
+	leases    map[string]memoryLease    // job ID -> lease
+	running   map[string]int            // API key ID -> leases held
+	ready     chan struct{}
+}
+
+type memoryLease struct {
+	task  string
+	owner string
+	until time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		strs:      map[string]string{},
+		hashes:    map[string]map[string]string{},
+		lists:     map[string][]string{},
+		zsets:     map[string]map[string]float64{},
+		streams:   map[string][]StreamEntry{},
+		expiry:    map[string]time.Time{},
+		subs:      map[string]map[chan struct{}]bool{},
+		lanes:     map[string][]string{},
+		rotations: map[string][]string{},
+		credits:   map[string]map[string]int{},
+		leases:    map[string]memoryLease{},
+		running:   map[string]int{},
+		// Same bound as the wake-up list in Redis
+		ready: make(chan struct{}, 1000),
+	}
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// lock takes the store mutex and purges expired keys once per sweepInterval
+func (s *MemoryStore) lock() {
+	s.mu.Lock()
+	now := time.Now()
+	if now.Before(s.nextSweep) {
+		return
+	}
+	for key, at := range s.expiry {
+		if !now.Before(at) {
+			s.drop(key)
+		}
+	}
+	s.nextSweep = now.Add(sweepInterval)
+}
+
+// live reports whether key exists, dropping it first if its TTL has passed
+func (s *MemoryStore) live(key string) bool {
+	if at, ok := s.expiry[key]; ok && !time.Now().Before(at) {
+		s.drop(key)
+	}
+	_, str := s.strs[key]
+	_, hash := s.hashes[key]
+	_, list := s.lists[key]
+	_, zset := s.zsets[key]
+	_, stream := s.streams[key]
+	return str || hash || list || zset || stream
+}
+
+func (s *MemoryStore) drop(key string) {
+	delete(s.strs, key)
+	delete(s.hashes, key)
+	delete(s.lists, key)
+	delete(s.zsets, key)
+	delete(s.streams, key)
+	delete(s.expiry, key)
+}
+
+func (s *MemoryStore) expire(key string, ttl time.Duration) {
+	if ttl > 0 {
+		s.expiry[key] = time.Now().Add(ttl)
+	} else {
+		delete(s.expiry, key)
+	}
+}
+
+// hash returns the hash at key, creating it if asked to
+func (s *MemoryStore) hash(key string, create bool) map[string]string {
+	if !s.live(key) && create {
+		s.hashes[key] = map[string]string{}
+	}
+	return s.hashes[key]
+}
+
+func (s *MemoryStore) zset(key string, create bool) map[string]float64 {
+	if !s.live(key) && create {
+		s.zsets[key] = map[string]float64{}
+	}
+	return s.zsets[key]
+}
+
+func (s *MemoryStore) setFields(key string, fields map[string]interface{}) map[string]string {
+	h := s.hash(key, true)
+	for field, value := range fields {
+		h[field] = fmt.Sprint(value)
+	}
+	return h
+}
+
+func (s *MemoryStore) CreateJob(ctx context.Context, jobID string, fields map[string]interface{}, ttl time.Duration, indexes []string) error {
+	s.lock()
+	defer s.mu.Unlock()
+	s.setFields(jobKey(jobID), fields)
+	s.expire(jobKey(jobID), ttl)
+	for _, index := range indexes {
+		s.zset(index, true)[jobID] = 0
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetJobs(ctx context.Context, jobIDs []string) ([]map[string]string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	records := make([]map[string]string, len(jobIDs))
+	for i, id := range jobIDs {
+		records[i] = map[string]string{}
+		for field, value := range s.hash(jobKey(id), false) {
+			records[i][field] = value
+		}
+	}
+	return records, nil
+}
+
+func (s *MemoryStore) UpdateJob(ctx context.Context, jobID string, fields map[string]interface{}, ttl time.Duration) error {
+	s.lock()
+	defer s.mu.Unlock()
+	key := jobKey(jobID)
+	status, ok := s.hash(key, false)["status"]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if Status(status).IsTerminal() {
+		return ErrJobFinished
+	}
+	if next, ok := fields["status"]; ok && fmt.Sprint(next) != status {
+		s.moveStatus(jobID, status, fmt.Sprint(next))
+	}
+	s.setFields(key, fields)
+	if at, ok := s.expiry[key]; !ok || time.Until(at) < ttl {
+		s.expire(key, ttl)
+	}
+	return nil
+}
+
+func (s *MemoryStore) moveStatus(jobID, from, to string) {
+	delete(s.zset(statusIndex(Status(from)), false), jobID)
+	s.zset(statusIndex(Status(to)), true)[jobID] = 0
+}
+
+func (s *MemoryStore) SetJobFields(ctx context.Context, jobID string, fields map[string]interface{}, ttl time.Duration) error {
+	s.lock()
+	defer s.mu.Unlock()
+	key := jobKey(jobID)
+	s.setFields(key, fields)
+	if at, ok := s.expiry[key]; ttl > 0 && ok && time.Until(at) < ttl {
+		s.expire(key, ttl)
+	}
+	return nil
+}
+
+func (s *MemoryStore) RangeIndex(ctx context.Context, indexes []string, lower, upper string, count int, desc bool) ([]string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	ids := []string{}
+	for id := range s.zset(indexes[0], false) {
+		if !inLexRange(id, lower, upper) {
+			continue
+		}
+		inAll := true
+		for _, index := range indexes[1:] {
+			if _, ok := s.zset(index, false)[id]; !ok {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			ids = append(ids, id)
+		}
+	}
+	// Every index member has score 0, so the order is lexicographic
+	if desc {
+		sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	} else {
+		sort.Strings(ids)
+	}
+	if count > 0 && len(ids) > count {
+		ids = ids[:count]
+	}
+	return ids, nil
+}
+
+// inLexRange checks member against bounds in ZRANGEBYLEX syntax
+func inLexRange(member, lower, upper string) bool {
+	switch {
+	case strings.HasPrefix(lower, "["):
+		if member < lower[1:] {
+			return false
+		}
+	case strings.HasPrefix(lower, "("):
+		if member <= lower[1:] {
+			return false
+		}
+	}
+	switch {
+	case strings.HasPrefix(upper, "["):
+		if member > upper[1:] {
+			return false
+		}
+	case strings.HasPrefix(upper, "("):
+		if member >= upper[1:] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *MemoryStore) RemoveFromIndexes(ctx context.Context, indexes []string, jobIDs []string) error {
+	s.lock()
+	defer s.mu.Unlock()
+	for _, index := range indexes {
+		set := s.zset(index, false)
+		for _, id := range jobIDs {
+			delete(set, id)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) TrimIndexes(ctx context.Context, prefix, before string) (int64, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	var removed int64
+	for key, set := range s.zsets {
+		if !strings.HasPrefix(key, prefix) || !s.live(key) {
+			continue
+		}
+		for id := range set {
+			if id < before && !s.live(jobKey(id)) {
+				delete(set, id)
+				removed++
+			}
+		}
+	}
+	return removed, nil
+}
+
+func (s *MemoryStore) Publish(ctx context.Context, jobID string) error {
+	s.lock()
+	defer s.mu.Unlock()
+	for ch := range s.subs[jobID] {
+		// Watchers reload the whole job, so pending notifications can be merged
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Subscribe(ctx context.Context, jobID string) (<-chan struct{}, func(), error) {
+	s.lock()
+	defer s.mu.Unlock()
+	ch := make(chan struct{}, 1)
+	if s.subs[jobID] == nil {
+		s.subs[jobID] = map[chan struct{}]bool{}
+	}
+	s.subs[jobID][ch] = true
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			delete(s.subs[jobID], ch)
+			if len(s.subs[jobID]) == 0 {
+				delete(s.subs, jobID)
+			}
+			close(ch)
+		})
+	}
+	return ch, unsubscribe, nil
+}
+
+func (s *MemoryStore) Push(ctx context.Context, payload string) error {
+	s.lock()
+	defer s.mu.Unlock()
+	return s.push(payload)
+}
+
+func (s *MemoryStore) push(payload string) error {
+	var task Task
+	if err := json.Unmarshal([]byte(payload), &task); err != nil {
+		return fmt.Errorf("failed to decode task: %w", err)
+	}
+	lane := task.Priority + ":" + task.Tenant
+	s.lanes[lane] = append(s.lanes[lane], payload)
+	if len(s.lanes[lane]) == 1 {
+		s.rotations[task.Priority] = append(removeString(s.rotations[task.Priority], task.Tenant), task.Tenant)
+	}
+	s.signal()
+	return nil
+}
+
+// signal leaves a wake-up token for an idle worker
+func (s *MemoryStore) signal() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (s *MemoryStore) PromoteDue(ctx context.Context, now time.Time) ([]string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	due := s.rangeScored(delayedKey, float64(now.UnixMilli()))
+	for _, payload := range due {
+		delete(s.zsets[delayedKey], payload)
+		if err := s.push(payload); err != nil {
+			continue
+		}
+		var task Task
+		_ = json.Unmarshal([]byte(payload), &task)
+		// A scheduled job becomes queued in the same step, as in promoteScript
+		job := s.hash(jobKey(task.JobID), false)
+		if job["status"] == string(StatusScheduled) {
+			job["status"] = string(StatusQueued)
+			delete(job, "scheduled_task")
+			s.moveStatus(task.JobID, string(StatusScheduled), string(StatusQueued))
+		}
+	}
+	return due, nil
+}
+
+func (s *MemoryStore) Pop(ctx context.Context, weights map[string]int, limit int, leaseUntil time.Time) (string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	for _, priority := range priorities {
+		if s.credits[priority] == nil {
+			s.credits[priority] = map[string]int{}
+		}
+		credits := s.credits[priority]
+		for range s.rotations[priority] {
+			rotation := s.rotations[priority]
+			if len(rotation) == 0 {
+				break
+			}
+			tenant := rotation[0]
+			lane := priority + ":" + tenant
+			if len(s.lanes[lane]) == 0 {
+				// Empty lane, drop the tenant from the rotation
+				s.rotations[priority] = rotation[1:]
+				delete(credits, tenant)
+				continue
+			}
+			head := s.lanes[lane][0]
+			var task Task
+			if err := json.Unmarshal([]byte(head), &task); err != nil {
+				return "", fmt.Errorf("failed to decode task: %w", err)
+			}
+			owner := task.KeyID
+			if owner == "" {
+				owner = "anonymous"
+			}
+			if limit > 0 && s.running[owner] >= limit {
+				s.rotations[priority] = append(rotation[1:], tenant)
+				delete(credits, tenant)
+				continue
+			}
+
+			s.lanes[lane] = s.lanes[lane][1:]
+			credits[tenant]++
+			weight := weights[tenant]
+			if weight < 1 {
+				weight = 1
+			}
+			if len(s.lanes[lane]) == 0 {
+				delete(s.lanes, lane)
+				s.rotations[priority] = rotation[1:]
+				delete(credits, tenant)
+			} else if credits[tenant] >= weight {
+				s.rotations[priority] = append(rotation[1:], tenant)
+				delete(credits, tenant)
+			}
+			s.running[owner]++
+			s.leases[task.JobID] = memoryLease{task: head, owner: owner, until: leaseUntil}
+			return head, nil
+		}
+	}
+	return "", nil
+}
+
+func (s *MemoryStore) WaitForWork(ctx context.Context, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-s.ready:
+		return nil
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *MemoryStore) RenewLease(ctx context.Context, jobID string, until time.Time) (bool, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	lease, ok := s.leases[jobID]
+	if !ok {
+		return false, nil
+	}
+	lease.until = until
+	s.leases[jobID] = lease
+	return true, nil
+}
+
+func (s *MemoryStore) ReleaseLease(ctx context.Context, jobID string) error {
+	s.lock()
+	defer s.mu.Unlock()
+	s.release(jobID)
+	return nil
+}
+
+// release drops the lease of one job and gives back its concurrency slot
+func (s *MemoryStore) release(jobID string) (string, bool) {
+	lease, ok := s.leases[jobID]
+	if !ok {
+		return "", false
+	}
+	delete(s.leases, jobID)
+	if s.running[lease.owner]--; s.running[lease.owner] <= 0 {
+		delete(s.running, lease.owner)
+	}
+	// A capped API key may have work waiting
+	s.signal()
+	return lease.task, true
+}
+
+func (s *MemoryStore) ExpireLeases(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	expired := []string{}
+	for id, lease := range s.leases {
+		if !lease.until.After(now) {
+			expired = append(expired, id)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return s.leases[expired[i]].until.Before(s.leases[expired[j]].until)
+	})
+	if len(expired) > limit {
+		expired = expired[:limit]
+	}
+	tasks := make([]string, 0, len(expired))
+	for _, id := range expired {
+		if task, ok := s.release(id); ok {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
+
+func (s *MemoryStore) AddScored(ctx context.Context, key, member string, score float64, onlyRaise bool) error {
+	s.lock()
+	defer s.mu.Unlock()
+	set := s.zset(key, true)
+	if current, ok := set[member]; ok && onlyRaise && score <= current {
+		return nil
+	}
+	set[member] = score
+	return nil
+}
+
+// rangeScored returns the members scored at most max, lowest first
+func (s *MemoryStore) rangeScored(key string, max float64) []string {
+	set := s.zset(key, false)
+	members := []string{}
+	for member, score := range set {
+		if score <= max {
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if set[members[i]] != set[members[j]] {
+			return set[members[i]] < set[members[j]]
+		}
+		return members[i] < members[j]
+	})
+	return members
+}
+
+func (s *MemoryStore) PopScored(ctx context.Context, key string, max float64, limit int) ([]string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	due := s.rangeScored(key, max)
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for _, member := range due {
+		delete(s.zsets[key], member)
+	}
+	return due, nil
+}
+
+func (s *MemoryStore) MoveScored(ctx context.Context, from, to string, max, score float64, limit int) ([]string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	due := s.rangeScored(from, max)
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for _, member := range due {
+		delete(s.zsets[from], member)
+		s.zset(to, true)[member] = score
+	}
+	return due, nil
+}
+
+func (s *MemoryStore) RangeScored(ctx context.Context, key string, max float64) ([]string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	return s.rangeScored(key, max), nil
+}
+
+func (s *MemoryStore) RemoveScored(ctx context.Context, key, member string) (bool, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	set := s.zset(key, false)
+	_, ok := set[member]
+	delete(set, member)
+	return ok, nil
+}
+
+func (s *MemoryStore) PushList(ctx context.Context, key, value string, maxLen int64, ttl time.Duration) error {
+	s.lock()
+	defer s.mu.Unlock()
+	s.live(key)
+	list := append(s.lists[key], value)
+	if maxLen > 0 && int64(len(list)) > maxLen {
+		list = list[int64(len(list))-maxLen:]
+	}
+	s.lists[key] = list
+	if ttl > 0 {
+		s.expire(key, ttl)
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	s.live(key)
+	list := s.lists[key]
+	n := int64(len(list))
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return []string{}, nil
+	}
+	return append([]string{}, list[start:stop+1]...), nil
+}
+
+func (s *MemoryStore) AppendStream(ctx context.Context, key string, values map[string]string, maxLen int64, ttl time.Duration) (string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	s.live(key)
+	stream := s.streams[key]
+
+	// Like Redis, take the current time unless the clock is behind the last entry
+	ms, seq := uint64(time.Now().UnixMilli()), uint64(0)
+	if n := len(stream); n > 0 {
+		lastMs, lastSeq, _ := parseStreamID(stream[n-1].ID)
+		if ms <= lastMs {
+			ms, seq = lastMs, lastSeq+1
+		}
+	}
+	entry := StreamEntry{ID: fmt.Sprintf("%d-%d", ms, seq), Values: map[string]string{}}
+	for k, v := range values {
+		entry.Values[k] = v
+	}
+
+	stream = append(stream, entry)
+	if maxLen > 0 && int64(len(stream)) > maxLen {
+		stream = stream[int64(len(stream))-maxLen:]
+	}
+	s.streams[key] = stream
+	if ttl > 0 {
+		s.expire(key, ttl)
+	}
+	return entry.ID, nil
+}
+
+func (s *MemoryStore) ReadStream(ctx context.Context, key, after string, count int64) ([]StreamEntry, error) {
+	var afterMs, afterSeq uint64
+	if after != "" {
+		var err error
+		if afterMs, afterSeq, err = parseStreamID(after); err != nil {
+			return nil, err
+		}
+	}
+
+	s.lock()
+	defer s.mu.Unlock()
+	s.live(key)
+	entries := []StreamEntry{}
+	for _, entry := range s.streams[key] {
+		if count > 0 && int64(len(entries)) >= count {
+			break
+		}
+		ms, seq, _ := parseStreamID(entry.ID)
+		if after != "" && (ms < afterMs || ms == afterMs && seq <= afterSeq) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (s *MemoryStore) HashSet(ctx context.Context, key, field, value string) error {
+	s.lock()
+	defer s.mu.Unlock()
+	s.hash(key, true)[field] = value
+	return nil
+}
+
+func (s *MemoryStore) HashGet(ctx context.Context, key, field string) (string, bool, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	value, ok := s.hash(key, false)[field]
+	return value, ok, nil
+}
+
+func (s *MemoryStore) HashGetAll(ctx context.Context, key string) (map[string]string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	all := map[string]string{}
+	for field, value := range s.hash(key, false) {
+		all[field] = value
+	}
+	return all, nil
+}
+
+func (s *MemoryStore) HashDelete(ctx context.Context, key, field string) (bool, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	h := s.hash(key, false)
+	_, ok := h[field]
+	delete(h, field)
+	return ok, nil
+}
+
+func (s *MemoryStore) HashIncr(ctx context.Context, key, field string, delta int64) (int64, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	h := s.hash(key, true)
+	value := int64(0)
+	if raw, ok := h[field]; ok {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("hash value is not an integer")
+		}
+		value = n
+	}
+	value += delta
+	h[field] = strconv.FormatInt(value, 10)
+	return value, nil
+}
+
+func (s *MemoryStore) SetIfAbsent(ctx context.Context, key, value string, ttl time.Duration) (string, bool, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	if s.live(key) {
+		return s.strs[key], false, nil
+	}
+	s.strs[key] = value
+	s.expire(key, ttl)
+	return "", true, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (string, bool, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	if !s.live(key) {
+		return "", false, nil
+	}
+	value, ok := s.strs[key]
+	return value, ok, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	s.lock()
+	defer s.mu.Unlock()
+	s.drop(key)
+	s.strs[key] = value
+	s.expire(key, ttl)
+	return nil
+}
+
+func (s *MemoryStore) Expire(ctx context.Context, key string, ttl time.Duration, onlyRaise bool) error {
+	s.lock()
+	defer s.mu.Unlock()
+	if !s.live(key) {
+		return nil
+	}
+	// Like EXPIRE GT, a key without a TTL counts as never expiring
+	if at, ok := s.expiry[key]; !onlyRaise || ok && time.Until(at) < ttl {
+		s.expire(key, ttl)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, keys ...string) error {
+	s.lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		s.drop(key)
+	}
+	return nil
+}
+
+func (s *MemoryStore) AcquireLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	if s.live(key) && s.strs[key] != owner {
+		return false, nil
+	}
+	s.strs[key] = owner
+	s.expire(key, ttl)
+	return true, nil
+}
+
+func (s *MemoryStore) ReleaseLock(ctx context.Context, key, owner string) error {
+	s.lock()
+	defer s.mu.Unlock()
+	if s.live(key) && s.strs[key] == owner {
+		s.drop(key)
+	}
+	return nil
+}
+
+func removeString(list []string, value string) []string {
+	kept := list[:0]
+	for _, item := range list {
+		if item != value {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,36 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"strconv"
+)
+
+// metricsKey is a hash of counters shared by every replica
+const metricsKey = "metrics"
+
+// Counter names
+const (
+	MetricCacheHits   = "result_cache_hits"
+	MetricCacheMisses = "result_cache_misses"
+)
+
+// CountMetric increments a counter; failures are logged and otherwise ignored
+func (jm *Manager) CountMetric(ctx context.Context, name string) {
+	if _, err := jm.store.HashIncr(ctx, metricsKey, name, 1); err != nil {
+		log.Printf("[WARN] [Jobs] Failed to count %s: %v", name, err)
+	}
+}
+
+// Metrics returns every counter
+func (jm *Manager) Metrics(ctx context.Context) (map[string]int64, error) {
+	raw, err := jm.store.HashGetAll(ctx, metricsKey)
+	if err != nil {
+		return nil, err
+	}
+	counters := map[string]int64{MetricCacheHits: 0, MetricCacheMisses: 0}
+	for name, value := range raw {
+		counters[name], _ = strconv.ParseInt(value, 10, 64)
+	}
+	return counters, nil
+}
@@ -0,0 +1,204 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"file-formatter-tools/internal/imgproc"
+)
+
+// SourceStep is the input name of the uploaded image in a pipeline graph
+const SourceStep = "source"
+
+const maxPipelineSteps = 32
+
+var stepIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Step states reported while a pipeline job runs
+const (
+	StepPending = "pending"
+	StepRunning = "running"
+	StepDone    = "done"
+	StepFailed  = "failed"
+)
+
+// StepStatus is the progress of one pipeline step
+type StepStatus struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Output string `json:"output,omitempty"`
+}
+
+// PlanPipeline validates a pipeline graph and returns its steps in dependency
+// order. A step without an ID gets "step<n>", and a step without an input
+// takes the previous step's image (the first one takes the source). If no
+// step names an output, the last step is uploaded as "result".
+func PlanPipeline(steps []Operation) ([]Operation, error) {
+	if len(steps) == 0 {
+		return nil, errors.New("a pipeline needs at least one step")
+	}
+	if len(steps) > maxPipelineSteps {
+		return nil, fmt.Errorf("a pipeline can have at most %d steps", maxPipelineSteps)
+	}
+
+	steps = append([]Operation{}, steps...)
+	byID := map[string]int{}
+	outputs := map[string]bool{}
+	for i := range steps {
+		op := &steps[i]
+		if op.ID == "" {
+			op.ID = "step" + strconv.Itoa(i+1)
+		}
+		if !stepIDPattern.MatchString(op.ID) || op.ID == SourceStep {
+			return nil, fmt.Errorf("invalid step id %q", op.ID)
+		}
+		if _, dup := byID[op.ID]; dup {
+			return nil, fmt.Errorf("duplicate step id %q", op.ID)
+		}
+		byID[op.ID] = i
+		if op.Input == "" {
+			op.Input = SourceStep
+			if i > 0 {
+				op.Input = steps[i-1].ID
+			}
+		}
+		if err := validateStep(op); err != nil {
+			return nil, fmt.Errorf("step %s: %w", op.ID, err)
+		}
+		if op.Output != "" {
+			if outputs[op.Output] {
+				return nil, fmt.Errorf("duplicate output name %q", op.Output)
+			}
+			outputs[op.Output] = true
+		}
+	}
+	if len(outputs) == 0 {
+		steps[len(steps)-1].Output = "result"
+	}
+
+	// Order steps so every input is computed first
+	ordered := make([]Operation, 0, len(steps))
+	state := map[string]int{} // 1 = visiting, 2 = done
+	var visit func(id string) error
+	visit = func(id string) error {
+		if id == SourceStep || state[id] == 2 {
+			return nil
+		}
+		i, ok := byID[id]
+		if !ok {
+			return fmt.Errorf("unknown input %q", id)
+		}
+		if state[id] == 1 {
+			return fmt.Errorf("steps form a cycle through %s", id)
+		}
+		state[id] = 1
+		if err := visit(steps[i].Input); err != nil {
+			return err
+		}
+		state[id] = 2
+		ordered = append(ordered, steps[i])
+		return nil
+	}
+	for _, op := range steps {
+		if err := visit(op.ID); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+func validateStep(op *Operation) error {
+	switch op.Type {
+	case "resize":
+		if op.Options.Width < 0 || op.Options.Height < 0 || op.Options.Width+op.Options.Height == 0 {
+			return errors.New("resize needs a positive width or height")
+		}
+		if err := op.Options.Spec().Validate(); err != nil {
+			return err
+		}
+	case "crop":
+		c := op.Crop
+		if c == nil {
+			return errors.New("crop needs an aspect or a rectangle")
+		}
+		if c.Aspect != "" {
+			if _, _, err := c.Ratio(); err != nil {
+				return err
+			}
+		} else if c.Width <= 0 || c.Height <= 0 || c.X < 0 || c.Y < 0 {
+			return errors.New("crop rectangle needs a positive width and height")
+		}
+	case "watermark":
+		w := op.Watermark
+		if w == nil || w.Text == "" {
+			return errors.New("watermark needs text")
+		}
+		if w.Opacity < 0 || w.Opacity > 1 {
+			return errors.New("watermark opacity must be between 0 and 1")
+		}
+		if w.Opacity == 0 {
+			w.Opacity = 0.5
+		}
+	case "encode":
+		if op.Output == "" {
+			return errors.New("encode needs an output name")
+		}
+	default:
+		return fmt.Errorf("unsupported operation type %q", op.Type)
+	}
+
+	if op.Output != "" && !stepIDPattern.MatchString(op.Output) {
+		return fmt.Errorf("invalid output name %q", op.Output)
+	}
+	// A resize step's output_format option means the same as the step's format
+	if op.Format == "" {
+		op.Format = op.Options.OutputFormat
+	}
+	format, err := imgproc.NormalizeFormat(op.Format)
+	if err != nil {
+		return err
+	}
+	op.Format = format
+	if op.Quality < 0 || op.Quality > 100 {
+		return errors.New("quality must be between 1 and 100")
+	}
+	if op.Quality == 0 {
+		op.Quality = 85
+	}
+	return nil
+}
+
+// Ratio parses Aspect, e.g. "4:3"
+func (c CropOptions) Ratio() (int, int, error) {
+	rawW, rawH, ok := strings.Cut(c.Aspect, ":")
+	w, errW := strconv.Atoi(rawW)
+	h, errH := strconv.Atoi(rawH)
+	if !ok || errW != nil || errH != nil || w <= 0 || h <= 0 {
+		return 0, 0, fmt.Errorf("invalid aspect ratio %q, expected e.g. 4:3", c.Aspect)
+	}
+	return w, h, nil
+}
+
+// PendingSteps is the initial progress of a planned pipeline
+func PendingSteps(steps []Operation) []StepStatus {
+	status := make([]StepStatus, len(steps))
+	for i, op := range steps {
+		status[i] = StepStatus{ID: op.ID, Type: op.Type, Status: StepPending, Output: op.Output}
+	}
+	return status
+}
+
+// SetSteps records the progress of each step of a pipeline job
+func (jm *Manager) SetSteps(ctx context.Context, jobID string, steps []StepStatus) error {
+	encoded, err := json.Marshal(steps)
+	if err != nil {
+		return fmt.Errorf("failed to encode steps: %w", err)
+	}
+	return jm.update(ctx, jobID, map[string]interface{}{"steps": string(encoded)})
+}
@@ -0,0 +1,212 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"file-formatter-tools/internal/imgproc"
+)
+
+const delayedKey = "jobs:delayed"
+
+// ResizeOptions are the processing options persisted alongside a queued job
+type ResizeOptions struct {
+	Width          int  `json:"width"`
+	Height         int  `json:"height"`
+	MaintainAspect bool `json:"maintain_aspect"`
+	Quality        int  `json:"quality"`
+	MaxSizeKB      int  `json:"max_size_kb"`
+	// OutputFormat converts the image (jpeg, png, gif or webp); empty keeps the input's format
+	OutputFormat string `json:"output_format,omitempty"`
+	// IgnoreOrientation skips turning the image upright by its EXIF orientation
+	IgnoreOrientation bool `json:"ignore_orientation,omitempty"`
+	// Metadata is the policy for the input's EXIF data (safe or preserve); empty strips it
+	Metadata string `json:"metadata,omitempty"`
+
+	// Mode is fit, fill, pad or stretch; empty follows MaintainAspect (fit, else fill).
+	// See imgproc.ResizeSpec for the other fields.
+	Mode       string `json:"mode,omitempty"`
+	Anchor     string `json:"anchor,omitempty"`
+	Background string `json:"background,omitempty"`
+	Filter     string `json:"filter,omitempty"`
+	ShrinkOnly bool   `json:"shrink_only,omitempty"`
+}
+
+// Spec returns the geometry of the options for imgproc.Resize
+func (o ResizeOptions) Spec() imgproc.ResizeSpec {
+	mode := o.Mode
+	if mode == "" {
+		mode = imgproc.ModeFill
+		if o.MaintainAspect {
+			mode = imgproc.ModeFit
+		}
+	}
+	return imgproc.ResizeSpec{
+		Width:      o.Width,
+		Height:     o.Height,
+		Mode:       mode,
+		Anchor:     o.Anchor,
+		Background: o.Background,
+		Filter:     o.Filter,
+		ShrinkOnly: o.ShrinkOnly,
+	}
+}
+
+// Operation is one processing step of a pipeline: resize, crop, watermark,
+// or encode (which passes its input through, to write it in another format).
+// Without IDs and inputs, steps form a chain; see PlanPipeline for graphs.
+type Operation struct {
+	ID    string `json:"id,omitempty"`
+	Type  string `json:"type"`
+	Input string `json:"input,omitempty"` // step whose image this one takes
+
+	Options   ResizeOptions     `json:"options"`
+	Crop      *CropOptions      `json:"crop,omitempty"`
+	Watermark *WatermarkOptions `json:"watermark,omitempty"`
+
+	// Output names the image this step produces; named images are uploaded,
+	// encoded as Format (default: the source format) at Quality
+	Output  string `json:"output,omitempty"`
+	Format  string `json:"format,omitempty"`
+	Quality int    `json:"quality,omitempty"`
+}
+
+// CropOptions select either the largest centered region with an aspect ratio
+// such as "4:3", or an explicit rectangle
+type CropOptions struct {
+	Aspect string `json:"aspect,omitempty"`
+	X      int    `json:"x,omitempty"`
+	Y      int    `json:"y,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// WatermarkOptions place a text label in the bottom-right corner
+type WatermarkOptions struct {
+	Text    string  `json:"text"`
+	Opacity float64 `json:"opacity,omitempty"` // 0-1, default 0.5
+}
+
+// Task is a unit of work pulled from the queue by a worker
+type Task struct {
+	JobID       string        `json:"job_id"`
+	BatchID     string        `json:"batch_id,omitempty"`
+	Type        string        `json:"type"`
+	KeyID       string        `json:"api_key_id,omitempty"`
+	Priority    string        `json:"priority"`
+	Tenant      string        `json:"tenant"`
+	InputObject string        `json:"input_object"`
+	Filename    string        `json:"filename"`
+	Options     ResizeOptions `json:"options"`
+	Attempt     int           `json:"attempt"`
+	Retry       RetryPolicy   `json:"retry"`
+	EnqueuedAt  time.Time     `json:"enqueued_at"`
+
+	// Pipeline, if set, replaces Options with a sequence of steps
+	Pipeline []Operation `json:"pipeline,omitempty"`
+	// OutputObject is an explicit, permanent destination for the result
+	OutputObject string `json:"output_object,omitempty"`
+	// KeepInput leaves the input object in place, e.g. a source bucket prefix
+	KeepInput bool `json:"keep_input,omitempty"`
+	// SourceURL, if set, is fetched as the input instead of InputObject
+	SourceURL string `json:"source_url,omitempty"`
+	// CacheKey, if set, stores the result for reuse by identical requests
+	CacheKey string `json:"cache_key,omitempty"`
+}
+
+// Enqueue pushes a task onto the work queue lane for its priority and API key
+func (jm *Manager) Enqueue(ctx context.Context, task Task) error {
+	payload, err := jm.encodeTask(&task)
+	if err != nil {
+		return err
+	}
+	if err := jm.store.Push(ctx, string(payload)); err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to enqueue job %s: %v", task.JobID, err)
+		return err
+	}
+	log.Printf("[INFO] [Jobs] Enqueued job %s (type=%s, priority=%s)", task.JobID, task.Type, task.Priority)
+	return nil
+}
+
+// Dequeue returns the next task according to the scheduling policy, waiting up
+// to timeout for one to arrive. Returns nil, nil when no work is available.
+// The caller holds a lease on the task until it calls ReleaseLease and must
+// keep it alive with RenewLease.
+func (jm *Manager) Dequeue(ctx context.Context, timeout time.Duration) (*Task, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		raw, err := jm.store.Pop(ctx, jm.scheduler.weights, jm.scheduler.limit, time.Now().Add(jm.leaseTTL))
+		if err != nil {
+			return nil, err
+		}
+		if raw != "" {
+			var task Task
+			if err := json.Unmarshal([]byte(raw), &task); err != nil {
+				return nil, fmt.Errorf("failed to decode task: %w", err)
+			}
+			return &task, nil
+		}
+		if attempt == 0 {
+			// Nothing queued, sleep until a producer signals new work
+			if err := jm.store.WaitForWork(ctx, timeout); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+// EnqueueAt holds a task back until the given time, then a worker pool
+// moves it onto the work queue via PromoteDue
+func (jm *Manager) EnqueueAt(ctx context.Context, task Task, at time.Time) error {
+	payload, err := jm.encodeTask(&task)
+	if err != nil {
+		return err
+	}
+	if err := jm.store.AddScored(ctx, delayedKey, string(payload), float64(at.UnixMilli()), false); err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to schedule job %s: %v", task.JobID, err)
+		return err
+	}
+	return nil
+}
+
+// PromoteDue moves delayed tasks whose time has come onto the work queue.
+// Scheduled jobs become queued, and the batches they belong to are refreshed.
+func (jm *Manager) PromoteDue(ctx context.Context) (int, error) {
+	due, err := jm.store.PromoteDue(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	batches := map[string]bool{}
+	for _, payload := range due {
+		var task Task
+		if err := json.Unmarshal([]byte(payload), &task); err != nil {
+			continue
+		}
+		jm.publish(ctx, task.JobID)
+		if task.BatchID != "" {
+			batches[task.BatchID] = true
+		}
+	}
+	for batchID := range batches {
+		_ = jm.RefreshBatch(ctx, batchID)
+	}
+	return len(due), nil
+}
+
+// encodeTask stamps the task, resolves its queue lane and fills in the default
+// retry policy
+func (jm *Manager) encodeTask(task *Task) ([]byte, error) {
+	task.EnqueuedAt = time.Now()
+	jm.scheduler.lane(task)
+	if task.Retry.MaxAttempts == 0 {
+		task.Retry = jm.retry
+	}
+	payload, err := json.Marshal(task)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode task: %w", err)
+	}
+	return payload, nil
+}
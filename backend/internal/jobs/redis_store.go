@@ -0,0 +1,631 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisStore keeps jobs in Redis, shared by every API and worker replica.
+// Multi-key operations run as Lua scripts so they stay atomic.
+//
+// It needs a single Redis 7 node (LMOVE, EXPIRE GT, ZADD GT). The queue,
+// lease and update scripts derive key names from the data they read, such as
+// the job ID of a popped task, so they cannot declare them all in KEYS:
+// Redis Cluster and proxies that route by key are not supported.
+type RedisStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisStore(rdb *redis.Client) *RedisStore {
+	return &RedisStore{rdb: rdb}
+}
+
+func (s *RedisStore) Close() error {
+	return s.rdb.Close()
+}
+
+// updateScript applies field changes only while the job exists and is not in a
+// terminal state, so e.g. a worker cannot flip a cancelled job back to running.
+// A status change also moves the job between the status indexes. The TTL is
+// only ever raised, so an extended retention is not cut short.
+// Returns 1 if applied, 0 if the job is finished, -1 if it does not exist.
+var updateScript = redis.NewScript(`
+local status = redis.call('HGET', KEYS[1], 'status')
+if not status then
+	return -1
+end
+if status == 'succeeded' or status == 'failed' or status == 'cancelled' then
+	return 0
+end
+for i = 3, #ARGV, 2 do
+	if ARGV[i] == 'status' and ARGV[i + 1] ~= status then
+		redis.call('ZREM', 'jobs:index:status:' .. status, ARGV[2])
+		redis.call('ZADD', 'jobs:index:status:' .. ARGV[i + 1], 0, ARGV[2])
+	end
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 3))
+if redis.call('TTL', KEYS[1]) < tonumber(ARGV[1]) then
+	redis.call('EXPIRE', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+func (s *RedisStore) CreateJob(ctx context.Context, jobID string, fields map[string]interface{}, ttl time.Duration, indexes []string) error {
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, jobKey(jobID), fields)
+	pipe.Expire(ctx, jobKey(jobID), ttl)
+	for _, index := range indexes {
+		pipe.ZAdd(ctx, index, &redis.Z{Member: jobID})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetJobs fetches the records in one round trip
+func (s *RedisStore) GetJobs(ctx context.Context, jobIDs []string) ([]map[string]string, error) {
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(jobIDs))
+	for i, id := range jobIDs {
+		cmds[i] = pipe.HGetAll(ctx, jobKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	records := make([]map[string]string, len(jobIDs))
+	for i, cmd := range cmds {
+		records[i] = cmd.Val()
+	}
+	return records, nil
+}
+
+func (s *RedisStore) UpdateJob(ctx context.Context, jobID string, fields map[string]interface{}, ttl time.Duration) error {
+	args := make([]interface{}, 0, 2+2*len(fields))
+	args = append(args, int(ttl.Seconds()), jobID)
+	for k, v := range fields {
+		args = append(args, k, v)
+	}
+	res, err := updateScript.Run(ctx, s.rdb, []string{jobKey(jobID)}, args...).Int()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case -1:
+		return ErrJobNotFound
+	case 0:
+		return ErrJobFinished
+	}
+	return nil
+}
+
+func (s *RedisStore) SetJobFields(ctx context.Context, jobID string, fields map[string]interface{}, ttl time.Duration) error {
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, jobKey(jobID), fields)
+	if ttl > 0 {
+		pipe.ExpireGT(ctx, jobKey(jobID), ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStore) RangeIndex(ctx context.Context, indexes []string, lower, upper string, count int, desc bool) ([]string, error) {
+	source := indexes[0]
+	if len(indexes) > 1 {
+		// Intersect into a short-lived scratch set
+		source = "jobs:index:tmp:" + NewID()
+		pipe := s.rdb.TxPipeline()
+		pipe.ZInterStore(ctx, source, &redis.ZStore{Keys: indexes})
+		pipe.Expire(ctx, source, 30*time.Second)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+		defer s.rdb.Del(context.WithoutCancel(ctx), source)
+	}
+	rng := &redis.ZRangeBy{Min: lower, Max: upper, Count: int64(count)}
+	if desc {
+		return s.rdb.ZRevRangeByLex(ctx, source, rng).Result()
+	}
+	return s.rdb.ZRangeByLex(ctx, source, rng).Result()
+}
+
+func (s *RedisStore) RemoveFromIndexes(ctx context.Context, indexes []string, jobIDs []string) error {
+	members := make([]interface{}, len(jobIDs))
+	for i, id := range jobIDs {
+		members[i] = id
+	}
+	pipe := s.rdb.Pipeline()
+	for _, index := range indexes {
+		pipe.ZRem(ctx, index, members...)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStore) TrimIndexes(ctx context.Context, prefix, before string) (int64, error) {
+	var removed int64
+	iter := s.rdb.Scan(ctx, 0, prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		n, err := s.trimIndex(ctx, iter.Val(), before)
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+	}
+	return removed, iter.Err()
+}
+
+// trimIndex pages through one index and removes the IDs whose record is gone
+func (s *RedisStore) trimIndex(ctx context.Context, index, before string) (int64, error) {
+	var removed int64
+	lower := "-"
+	for {
+		ids, err := s.rdb.ZRangeByLex(ctx, index, &redis.ZRangeBy{Min: lower, Max: "(" + before, Count: 500}).Result()
+		if err != nil || len(ids) == 0 {
+			return removed, err
+		}
+		pipe := s.rdb.Pipeline()
+		exists := make([]*redis.IntCmd, len(ids))
+		for i, id := range ids {
+			exists[i] = pipe.Exists(ctx, jobKey(id))
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return removed, err
+		}
+		gone := []interface{}{}
+		for i, cmd := range exists {
+			if cmd.Val() == 0 {
+				gone = append(gone, ids[i])
+			}
+		}
+		if len(gone) > 0 {
+			n, err := s.rdb.ZRem(ctx, index, gone...).Result()
+			if err != nil {
+				return removed, err
+			}
+			removed += n
+		}
+		lower = "(" + ids[len(ids)-1]
+	}
+}
+
+func eventsChannel(jobID string) string {
+	return fmt.Sprintf("job:%s:events", jobID)
+}
+
+func (s *RedisStore) Publish(ctx context.Context, jobID string) error {
+	return s.rdb.Publish(ctx, eventsChannel(jobID), jobID).Err()
+}
+
+func (s *RedisStore) Subscribe(ctx context.Context, jobID string) (<-chan struct{}, func(), error) {
+	sub := s.rdb.Subscribe(ctx, eventsChannel(jobID))
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, nil, err
+	}
+	notifications := make(chan struct{}, 1)
+	go func() {
+		defer close(notifications)
+		for range sub.Channel() {
+			// Watchers reload the whole job, so pending notifications can be merged
+			select {
+			case notifications <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return notifications, func() { sub.Close() }, nil
+}
+
+// Queue layout: each (priority, tenant) pair has its own list
+// jobs:queue:<priority>:<tenant>, and jobs:rr:<priority> is the rotation of
+// tenants with queued work at that priority. jobs:ready carries wake-up
+// tokens for idle workers.
+//
+// pushLua routes an encoded task to its lane and adds the tenant to the rotation
+const pushLua = `
+local function push(task)
+	local t = cjson.decode(task)
+	local queue = 'jobs:queue:' .. t.priority .. ':' .. t.tenant
+	local rotation = 'jobs:rr:' .. t.priority
+	if redis.call('LPUSH', queue, task) == 1 then
+		redis.call('LREM', rotation, 0, t.tenant)
+		redis.call('RPUSH', rotation, t.tenant)
+	end
+	redis.call('LPUSH', 'jobs:ready', 1)
+	redis.call('LTRIM', 'jobs:ready', 0, 999)
+end
+`
+
+var enqueueScript = redis.NewScript(pushLua + `
+push(ARGV[1])
+return 1
+`)
+
+func (s *RedisStore) Push(ctx context.Context, payload string) error {
+	return enqueueScript.Run(ctx, s.rdb, nil, payload).Err()
+}
+
+// promoteScript moves every delayed task that is due onto its lane and returns
+// them. A job that was scheduled becomes queued in the same step, so it is
+// never listed as scheduled while it waits in a lane.
+var promoteScript = redis.NewScript(pushLua + `
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+for _, task in ipairs(due) do
+	redis.call('ZREM', KEYS[1], task)
+	push(task)
+	local id = cjson.decode(task).job_id
+	local key = 'job:' .. id
+	if redis.call('HGET', key, 'status') == 'scheduled' then
+		redis.call('HSET', key, 'status', 'queued')
+		redis.call('HDEL', key, 'scheduled_task')
+		redis.call('ZREM', 'jobs:index:status:scheduled', id)
+		redis.call('ZADD', 'jobs:index:status:queued', 0, id)
+	end
+end
+return due
+`)
+
+func (s *RedisStore) PromoteDue(ctx context.Context, now time.Time) ([]string, error) {
+	return promoteScript.Run(ctx, s.rdb, []string{delayedKey}, now.UnixMilli()).StringSlice()
+}
+
+// dequeueScript pops the next task and leases it to the caller. ARGV[1] is a
+// JSON object of tenant weights, ARGV[2] the per-API-key concurrency limit
+// (0 = none), ARGV[3] the lease deadline and ARGV[4..] the priority levels in
+// order. The tenant at the head of a rotation is served until it has used its
+// weight, then moves to the back; a tenant whose API key is at its limit is
+// passed over. Under the fifo policy there is a single lane, so a capped key
+// holds up the jobs queued behind it.
+var dequeueScript = redis.NewScript(`
+local weights = cjson.decode(ARGV[1])
+local limit = tonumber(ARGV[2])
+for i = 4, #ARGV do
+	local priority = ARGV[i]
+	local rotation = 'jobs:rr:' .. priority
+	local credits = 'jobs:rr:credits:' .. priority
+	for _ = 1, redis.call('LLEN', rotation) do
+		local tenant = redis.call('LINDEX', rotation, 0)
+		if not tenant then
+			break
+		end
+		local queue = 'jobs:queue:' .. priority .. ':' .. tenant
+		local head = redis.call('LINDEX', queue, -1)
+		if not head then
+			-- Empty lane, drop the tenant from the rotation
+			redis.call('LPOP', rotation)
+			redis.call('HDEL', credits, tenant)
+		else
+			local t = cjson.decode(head)
+			local owner = t.api_key_id or 'anonymous'
+			if limit > 0 and tonumber(redis.call('HGET', 'jobs:running', owner) or '0') >= limit then
+				redis.call('LMOVE', rotation, rotation, 'LEFT', 'RIGHT')
+				redis.call('HDEL', credits, tenant)
+			else
+				redis.call('RPOP', queue)
+				local used = redis.call('HINCRBY', credits, tenant, 1)
+				if redis.call('LLEN', queue) == 0 then
+					redis.call('LPOP', rotation)
+					redis.call('HDEL', credits, tenant)
+				elseif used >= (tonumber(weights[tenant]) or 1) then
+					redis.call('LMOVE', rotation, rotation, 'LEFT', 'RIGHT')
+					redis.call('HDEL', credits, tenant)
+				end
+				redis.call('HINCRBY', 'jobs:running', owner, 1)
+				redis.call('ZADD', 'jobs:leases', ARGV[3], t.job_id)
+				redis.call('HSET', 'jobs:leases:tasks', t.job_id, head)
+				return head
+			end
+		end
+	end
+end
+return false
+`)
+
+func (s *RedisStore) Pop(ctx context.Context, weights map[string]int, limit int, leaseUntil time.Time) (string, error) {
+	if weights == nil {
+		weights = map[string]int{} // encoded as {}, the script cannot index null
+	}
+	encoded, err := json.Marshal(weights)
+	if err != nil {
+		return "", err
+	}
+	args := []interface{}{string(encoded), limit, leaseUntil.UnixMilli()}
+	for _, p := range priorities {
+		args = append(args, p)
+	}
+	raw, err := dequeueScript.Run(ctx, s.rdb, nil, args...).Text()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return raw, err
+}
+
+// WaitForWork sleeps on the wake-up tokens pushed with every task
+func (s *RedisStore) WaitForWork(ctx context.Context, timeout time.Duration) error {
+	if err := s.rdb.BRPop(ctx, timeout, readyKey).Err(); err != nil && err != redis.Nil {
+		return err
+	}
+	return nil
+}
+
+// Every dequeued task is leased (see dequeueScript): jobs:leases scores job IDs
+// by lease deadline, jobs:leases:tasks keeps the leased payloads so an expired
+// one can be re-run, and jobs:running counts the leases held per API key.
+//
+// releaseLua drops the lease of one job and gives back its concurrency slot.
+// Returns the leased payload, or false if the job held no lease.
+const releaseLua = `
+local function release(id)
+	local task = redis.call('HGET', 'jobs:leases:tasks', id)
+	redis.call('ZREM', 'jobs:leases', id)
+	if not task then
+		return false
+	end
+	redis.call('HDEL', 'jobs:leases:tasks', id)
+	local owner = cjson.decode(task).api_key_id or 'anonymous'
+	if redis.call('HINCRBY', 'jobs:running', owner, -1) <= 0 then
+		redis.call('HDEL', 'jobs:running', owner)
+	end
+	-- A capped API key may have work waiting
+	redis.call('LPUSH', 'jobs:ready', 1)
+	redis.call('LTRIM', 'jobs:ready', 0, 999)
+	return task
+end
+`
+
+var releaseLeaseScript = redis.NewScript(releaseLua + `
+return release(ARGV[1])
+`)
+
+// renewLeaseScript extends a lease only while it is still held
+var renewLeaseScript = redis.NewScript(`
+if redis.call('HEXISTS', 'jobs:leases:tasks', ARGV[1]) == 0 then
+	return 0
+end
+redis.call('ZADD', 'jobs:leases', ARGV[2], ARGV[1])
+return 1
+`)
+
+// expireLeasesScript releases every lease whose deadline passed and returns the payloads
+var expireLeasesScript = redis.NewScript(releaseLua + `
+local expired = redis.call('ZRANGEBYSCORE', 'jobs:leases', '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+local tasks = {}
+for _, id in ipairs(expired) do
+	local task = release(id)
+	if task then
+		table.insert(tasks, task)
+	end
+end
+return tasks
+`)
+
+func (s *RedisStore) RenewLease(ctx context.Context, jobID string, until time.Time) (bool, error) {
+	res, err := renewLeaseScript.Run(ctx, s.rdb, nil, jobID, until.UnixMilli()).Int()
+	if err != nil {
+		return false, err
+	}
+	return res == 1, nil
+}
+
+func (s *RedisStore) ReleaseLease(ctx context.Context, jobID string) error {
+	err := releaseLeaseScript.Run(ctx, s.rdb, nil, jobID).Err()
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
+
+func (s *RedisStore) ExpireLeases(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	expired, err := expireLeasesScript.Run(ctx, s.rdb, nil, now.UnixMilli(), limit).StringSlice()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return expired, err
+}
+
+func (s *RedisStore) AddScored(ctx context.Context, key, member string, score float64, onlyRaise bool) error {
+	return s.rdb.ZAddArgs(ctx, key, redis.ZAddArgs{
+		GT:      onlyRaise,
+		Members: []redis.Z{{Score: score, Member: member}},
+	}).Err()
+}
+
+// popDueScript removes and returns up to ARGV[2] members scored at most ARGV[1]
+var popDueScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+if #due > 0 then
+	redis.call('ZREM', KEYS[1], unpack(due))
+end
+return due
+`)
+
+func (s *RedisStore) PopScored(ctx context.Context, key string, max float64, limit int) ([]string, error) {
+	return popDueScript.Run(ctx, s.rdb, []string{key}, formatScore(max), limit).StringSlice()
+}
+
+// moveDueScript moves up to ARGV[3] members scored at most ARGV[1] from
+// KEYS[1] to KEYS[2], rescored to ARGV[2], and returns them
+var moveDueScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, member in ipairs(due) do
+	redis.call('ZREM', KEYS[1], member)
+	redis.call('ZADD', KEYS[2], ARGV[2], member)
+end
+return due
+`)
+
+func (s *RedisStore) MoveScored(ctx context.Context, from, to string, max, score float64, limit int) ([]string, error) {
+	return moveDueScript.Run(ctx, s.rdb, []string{from, to}, formatScore(max), formatScore(score), limit).StringSlice()
+}
+
+func (s *RedisStore) RangeScored(ctx context.Context, key string, max float64) ([]string, error) {
+	return s.rdb.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: "-inf", Max: formatScore(max)}).Result()
+}
+
+func (s *RedisStore) RemoveScored(ctx context.Context, key, member string) (bool, error) {
+	removed, err := s.rdb.ZRem(ctx, key, member).Result()
+	return removed > 0, err
+}
+
+func (s *RedisStore) PushList(ctx context.Context, key, value string, maxLen int64, ttl time.Duration) error {
+	pipe := s.rdb.TxPipeline()
+	pipe.RPush(ctx, key, value)
+	if maxLen > 0 {
+		pipe.LTrim(ctx, key, -maxLen, -1)
+	}
+	if ttl > 0 {
+		pipe.Expire(ctx, key, ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStore) ListRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return s.rdb.LRange(ctx, key, start, stop).Result()
+}
+
+func (s *RedisStore) AppendStream(ctx context.Context, key string, values map[string]string, maxLen int64, ttl time.Duration) (string, error) {
+	pipe := s.rdb.TxPipeline()
+	add := pipe.XAdd(ctx, &redis.XAddArgs{Stream: key, MaxLen: maxLen, Approx: true, Values: values})
+	if ttl > 0 {
+		pipe.Expire(ctx, key, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return add.Val(), nil
+}
+
+func (s *RedisStore) ReadStream(ctx context.Context, key, after string, count int64) ([]StreamEntry, error) {
+	start := "-"
+	if after != "" {
+		next, err := nextStreamID(after)
+		if err != nil {
+			return nil, err
+		}
+		start = next
+	}
+	messages, err := s.rdb.XRangeN(ctx, key, start, "+", count).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]StreamEntry, 0, len(messages))
+	for _, msg := range messages {
+		values := make(map[string]string, len(msg.Values))
+		for k, v := range msg.Values {
+			values[k] = fmt.Sprint(v)
+		}
+		entries = append(entries, StreamEntry{ID: msg.ID, Values: values})
+	}
+	return entries, nil
+}
+
+func (s *RedisStore) HashSet(ctx context.Context, key, field, value string) error {
+	return s.rdb.HSet(ctx, key, field, value).Err()
+}
+
+func (s *RedisStore) HashGet(ctx context.Context, key, field string) (string, bool, error) {
+	value, err := s.rdb.HGet(ctx, key, field).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	return value, err == nil, err
+}
+
+func (s *RedisStore) HashGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return s.rdb.HGetAll(ctx, key).Result()
+}
+
+func (s *RedisStore) HashDelete(ctx context.Context, key, field string) (bool, error) {
+	removed, err := s.rdb.HDel(ctx, key, field).Result()
+	return removed > 0, err
+}
+
+func (s *RedisStore) HashIncr(ctx context.Context, key, field string, delta int64) (int64, error) {
+	return s.rdb.HIncrBy(ctx, key, field, delta).Result()
+}
+
+// setIfAbsentScript returns the existing value, or stores ARGV[1] and returns nil
+var setIfAbsentScript = redis.NewScript(`
+local existing = redis.call('GET', KEYS[1])
+if existing then
+	return existing
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return false
+`)
+
+func (s *RedisStore) SetIfAbsent(ctx context.Context, key, value string, ttl time.Duration) (string, bool, error) {
+	existing, err := setIfAbsentScript.Run(ctx, s.rdb, []string{key}, value, ttl.Milliseconds()).Text()
+	if err == redis.Nil {
+		return "", true, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return existing, false, nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (string, bool, error) {
+	value, err := s.rdb.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	return value, err == nil, err
+}
+
+func (s *RedisStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return s.rdb.Set(ctx, key, value, ttl).Err()
+}
+
+func (s *RedisStore) Expire(ctx context.Context, key string, ttl time.Duration, onlyRaise bool) error {
+	if onlyRaise {
+		return s.rdb.ExpireGT(ctx, key, ttl).Err()
+	}
+	return s.rdb.Expire(ctx, key, ttl).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) error {
+	return s.rdb.Del(ctx, keys...).Err()
+}
+
+// lockScript takes the lock, or extends it if owner already holds it
+var lockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// unlockScript drops the lock only if owner still holds it
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+func (s *RedisStore) AcquireLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	res, err := lockScript.Run(ctx, s.rdb, []string{key}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return res == 1, nil
+}
+
+func (s *RedisStore) ReleaseLock(ctx context.Context, key, owner string) error {
+	return unlockScript.Run(ctx, s.rdb, []string{key}, owner).Err()
+}
+
+// formatScore renders a score bound without exponent notation
+func formatScore(score float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%f", score), "0"), ".")
+}
@@ -0,0 +1,122 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// objectExpiryKey is a sorted set of S3 object names scored by deletion time
+const objectExpiryKey = "objects:expiry"
+
+// ScheduleDeletion records that an S3 object should be removed at the given time
+func (jm *Manager) ScheduleDeletion(ctx context.Context, objectName string, at time.Time) error {
+	err := jm.store.AddScored(ctx, objectExpiryKey, objectName, float64(at.Unix()), false)
+	if err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to schedule deletion of %s: %v", objectName, err)
+	}
+	return err
+}
+
+// ScheduleOutputDeletion schedules the deletion of an output object and
+// remembers the job that produced it, so its expiry shows in the job's history
+func (jm *Manager) ScheduleOutputDeletion(ctx context.Context, jobID, objectName string, at time.Time) error {
+	if err := jm.store.HashSet(ctx, objectOwnerKey, objectName, jobID); err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to record owner of %s: %v", objectName, err)
+		return err
+	}
+	return jm.ScheduleDeletion(ctx, objectName, at)
+}
+
+// DueDeletions pops up to limit objects whose retention has ended
+func (jm *Manager) DueDeletions(ctx context.Context, limit int) ([]string, error) {
+	return jm.store.PopScored(ctx, objectExpiryKey, float64(time.Now().Unix()), limit)
+}
+
+// Extend keeps a job, its batch children and their output objects for d from
+// now (capped at the configured maximum, and at the longest a job record may
+// live from creation). Returns the new retention deadline. Download URLs are
+// not re-issued here; see SetOutputs.
+func (jm *Manager) Extend(ctx context.Context, jobID string, d time.Duration) (time.Time, error) {
+	if d > jm.maxRetention {
+		d = jm.maxRetention
+	}
+	until := time.Now().Add(d)
+
+	job, err := jm.GetJob(ctx, jobID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var limit time.Time
+	if job.CreatedAt != nil {
+		limit = job.CreatedAt.Add(jm.maxLifetime)
+		if until.After(limit) {
+			until = limit
+		}
+	}
+	all := []*Job{job}
+	children, err := jm.Children(ctx, jobID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	all = append(all, children...)
+
+	// The record itself always lives at least the normal retention, up to the limit
+	recordTTL := time.Until(until)
+	if recordTTL < jm.retention {
+		recordTTL = jm.retention
+	}
+	if !limit.IsZero() && recordTTL > time.Until(limit) {
+		recordTTL = time.Until(limit)
+	}
+
+	err = jm.extend(ctx, all, until, recordTTL)
+	if err == nil && len(children) > 0 && recordTTL > 0 {
+		err = jm.store.Expire(ctx, childrenKey(jobID), recordTTL, true)
+	}
+	if err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to extend retention of job %s: %v", jobID, err)
+		return time.Time{}, err
+	}
+	jm.publish(ctx, jobID)
+	jm.RecordEvent(ctx, jobID, EventExtended, map[string]interface{}{"retain_until": formatTime(until)})
+	log.Printf("[INFO] [Jobs] Extended retention of job %s until %s", jobID, until.Format(time.RFC3339))
+	return until, nil
+}
+
+// extend raises the retention of each job to until. Record TTLs are only
+// ever raised, so a scheduled job keeps the time it needs to run.
+func (jm *Manager) extend(ctx context.Context, all []*Job, until time.Time, recordTTL time.Duration) error {
+	for _, j := range all {
+		// Never shorten an existing retention
+		if j.RetainUntil != nil && j.RetainUntil.After(until) {
+			continue
+		}
+		if err := jm.store.SetJobFields(ctx, j.ID, map[string]interface{}{"retain_until": formatTime(until)}, recordTTL); err != nil {
+			return err
+		}
+		for _, out := range j.Outputs {
+			if err := jm.store.AddScored(ctx, objectExpiryKey, out.ObjectName, float64(until.Unix()), true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SetOutputs replaces the outputs of a job, e.g. with re-issued download URLs.
+// Unlike state changes this is allowed on finished jobs.
+func (jm *Manager) SetOutputs(ctx context.Context, jobID string, outputs []Output) error {
+	encoded, err := json.Marshal(outputs)
+	if err != nil {
+		return fmt.Errorf("failed to encode outputs: %w", err)
+	}
+	if err := jm.store.SetJobFields(ctx, jobID, map[string]interface{}{"outputs": string(encoded)}, 0); err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to set outputs of job %s: %v", jobID, err)
+		return err
+	}
+	jm.publish(ctx, jobID)
+	return nil
+}
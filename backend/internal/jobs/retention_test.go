@@ -0,0 +1,111 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"file-formatter-tools/internal/config"
+)
+
+func TestTrimIndexesKeepsLiveJobs(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	// Every job is past MaxRetention almost at once
+	jm := NewManager(store, &config.Config{
+		JobRetention:     time.Hour,
+		MaxRetention:     time.Millisecond,
+		MaxScheduleDelay: 48 * time.Hour,
+	})
+
+	scheduled, err := jm.NewJob(ctx, Spec{Type: "resize", RunAt: time.Now().Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	extended, err := jm.NewJob(ctx, Spec{Type: "resize"})
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	if _, err := jm.Extend(ctx, extended, time.Hour); err != nil {
+		t.Fatalf("Extend: %v", err)
+	}
+	expired, err := jm.NewJob(ctx, Spec{Type: "resize"})
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	if err := store.Delete(ctx, jobKey(expired)); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := jm.TrimIndexes(ctx); err != nil {
+		t.Fatalf("TrimIndexes: %v", err)
+	}
+	for _, index := range []string{indexAll, statusIndex(StatusScheduled), statusIndex(StatusQueued)} {
+		if _, ok := store.zset(index, false)[expired]; ok {
+			t.Errorf("%s still holds the expired job", index)
+		}
+	}
+	listed, _, err := jm.List(ctx, Filter{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	ids := map[string]bool{}
+	for _, job := range listed {
+		ids[job.ID] = true
+	}
+	if !ids[scheduled] || !ids[extended] {
+		t.Errorf("List = %v, want the scheduled job %s and the extended job %s", ids, scheduled, extended)
+	}
+}
+
+func TestExtendNeverShortensTheRecord(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	jm := NewManager(store, &config.Config{
+		JobRetention:     time.Hour,
+		MaxRetention:     2 * time.Hour,
+		MaxScheduleDelay: 48 * time.Hour,
+	})
+
+	scheduled, err := jm.NewJob(ctx, Spec{Type: "resize", RunAt: time.Now().Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	if _, err := jm.Extend(ctx, scheduled, time.Hour); err != nil {
+		t.Fatalf("Extend: %v", err)
+	}
+	if left := time.Until(store.expiry[jobKey(scheduled)]); left < 24*time.Hour {
+		t.Errorf("scheduled job record expires in %s, want it kept past its run", left)
+	}
+
+	plain, err := jm.NewJob(ctx, Spec{Type: "resize"})
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	if _, err := jm.Extend(ctx, plain, 2*time.Hour); err != nil {
+		t.Fatalf("Extend: %v", err)
+	}
+	if left := time.Until(store.expiry[jobKey(plain)]); left < 2*time.Hour-time.Minute {
+		t.Errorf("extended job record expires in %s, want about 2h", left)
+	}
+
+	// A job never lives past MaxRetention + MaxScheduleDelay from creation
+	capped := NewManager(store, &config.Config{JobRetention: time.Hour, MaxRetention: 2 * time.Hour})
+	jobID, err := capped.NewJob(ctx, Spec{Type: "resize"})
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	until, err := capped.Extend(ctx, jobID, 2*time.Hour)
+	if err != nil {
+		t.Fatalf("Extend: %v", err)
+	}
+	job, err := capped.GetJob(ctx, jobID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if limit := job.CreatedAt.Add(2 * time.Hour); !until.Equal(limit) {
+		t.Errorf("Extend kept the job until %s, want %s", until, limit)
+	}
+}
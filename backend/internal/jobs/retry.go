@@ -0,0 +1,109 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const deadLetterKey = "jobs:dead"
+
+// maxDeadLetters is how many dead letters are kept; older ones are dropped
+const maxDeadLetters = 1000
+
+// RetryPolicy controls how often a job is re-run after a transient failure
+type RetryPolicy struct {
+	MaxAttempts int           `json:"max_attempts"`
+	BaseDelay   time.Duration `json:"base_delay"`
+	MaxDelay    time.Duration `json:"max_delay"`
+}
+
+// Backoff returns the delay before the next attempt after `attempt` failed
+// attempts: exponential from BaseDelay, capped at MaxDelay (0 = no cap), with
+// up to 20% jitter
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay == 0 || delay < p.MaxDelay) && delay < math.MaxInt64/2; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay > 0 {
+		delay += time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	}
+	return delay
+}
+
+// DeadLetter is a job that exhausted its retries, kept for inspection by ops
+type DeadLetter struct {
+	Task     Task      `json:"task"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// RetryJob puts a failed attempt back in the queue after the policy's backoff.
+// Returns false if the job has no attempts left.
+func (jm *Manager) RetryJob(ctx context.Context, task Task, cause error) (bool, error) {
+	if task.Attempt >= task.Retry.MaxAttempts {
+		return false, nil
+	}
+
+	retryAt := time.Now().Add(task.Retry.Backoff(task.Attempt))
+	err := jm.update(ctx, task.JobID, map[string]interface{}{
+		"status":          string(StatusQueued),
+		"progress":        0,
+		"last_error":      cause.Error(),
+		"next_attempt_at": formatTime(retryAt),
+	})
+	if err != nil {
+		return false, err
+	}
+	if err := jm.EnqueueAt(ctx, task, retryAt); err != nil {
+		return false, err
+	}
+	jm.RecordEvent(ctx, task.JobID, EventRetried, map[string]interface{}{
+		"attempt":         task.Attempt,
+		"error":           cause.Error(),
+		"next_attempt_at": formatTime(retryAt),
+	})
+	log.Printf("[WARN] [Jobs] Job %s attempt %d/%d failed, retrying at %s: %v", task.JobID, task.Attempt, task.Retry.MaxAttempts, retryAt.Format(time.RFC3339), cause)
+	return true, nil
+}
+
+// AddDeadLetter records a job that exhausted its retries. The list keeps the
+// newest maxDeadLetters and expires MaxRetention after the last failure.
+func (jm *Manager) AddDeadLetter(ctx context.Context, task Task, cause error) error {
+	payload, err := json.Marshal(DeadLetter{Task: task, Error: cause.Error(), FailedAt: time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter: %w", err)
+	}
+	if err := jm.store.PushList(ctx, deadLetterKey, string(payload), maxDeadLetters, jm.maxRetention); err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to dead-letter job %s: %v", task.JobID, err)
+		return err
+	}
+	log.Printf("[WARN] [Jobs] Job %s moved to dead-letter list after %d attempts", task.JobID, task.Attempt)
+	return nil
+}
+
+// DeadLetters returns the most recent dead-lettered jobs, newest first
+func (jm *Manager) DeadLetters(ctx context.Context, limit int64) ([]DeadLetter, error) {
+	raw, err := jm.store.ListRange(ctx, deadLetterKey, -limit, -1)
+	if err != nil {
+		return nil, err
+	}
+	letters := make([]DeadLetter, 0, len(raw))
+	for i := len(raw) - 1; i >= 0; i-- {
+		var letter DeadLetter
+		if err := json.Unmarshal([]byte(raw[i]), &letter); err != nil {
+			log.Printf("[WARN] [Jobs] Skipping malformed dead letter: %v", err)
+			continue
+		}
+		letters = append(letters, letter)
+	}
+	return letters, nil
+}
@@ -0,0 +1,55 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"file-formatter-tools/internal/config"
+)
+
+func TestDeadLettersAreCapped(t *testing.T) {
+	ctx := context.Background()
+	jm := NewManager(NewMemoryStore(), &config.Config{MaxRetention: time.Hour})
+	for i := 0; i < maxDeadLetters+5; i++ {
+		if err := jm.AddDeadLetter(ctx, Task{JobID: fmt.Sprint(i)}, errors.New("boom")); err != nil {
+			t.Fatalf("AddDeadLetter: %v", err)
+		}
+	}
+
+	letters, err := jm.DeadLetters(ctx, 2*maxDeadLetters)
+	if err != nil {
+		t.Fatalf("DeadLetters: %v", err)
+	}
+	if len(letters) != maxDeadLetters {
+		t.Fatalf("kept %d dead letters, want %d", len(letters), maxDeadLetters)
+	}
+	// Newest first; the oldest were dropped
+	if first, last := letters[0].Task.JobID, letters[len(letters)-1].Task.JobID; first != fmt.Sprint(maxDeadLetters+4) || last != "5" {
+		t.Errorf("dead letters run from %s to %s", first, last)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{"first", RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute}, 1, time.Second},
+		{"doubles", RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute}, 4, 8 * time.Second},
+		{"capped", RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute}, 10, time.Minute},
+		{"no cap", RetryPolicy{BaseDelay: time.Second}, 10, 512 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.Backoff(tt.attempt)
+			if got < tt.want || got > tt.want+tt.want/5 {
+				t.Errorf("Backoff(%d) = %s, want %s plus up to 20%% jitter", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"file-formatter-tools/internal/auth"
+	"file-formatter-tools/internal/config"
+)
+
+// Priority levels; higher levels are always served first
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+var priorities = []string{PriorityHigh, PriorityNormal, PriorityLow}
+
+// ValidPriority reports whether p is a known priority level
+func ValidPriority(p string) bool {
+	for _, known := range priorities {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Scheduling policies
+const (
+	// PolicyFair serves priority levels in order and, within a level, rotates
+	// between API keys weighted by their configured share
+	PolicyFair = "fair"
+	// PolicyFIFO ignores priority and API key and serves jobs in arrival order
+	PolicyFIFO = "fifo"
+)
+
+// fifoTenant is the single lane every job goes to under PolicyFIFO
+const fifoTenant = "*"
+
+// readyKey carries wake-up tokens for idle workers
+const readyKey = "jobs:ready"
+
+// scheduler holds the queueing policy resolved from config
+type scheduler struct {
+	policy  string
+	weights map[string]int // tenant -> consecutive turns in the rotation
+	limit   int            // concurrent jobs per API key, 0 = unlimited
+}
+
+func newScheduler(cfg *config.Config) scheduler {
+	weights := map[string]int{}
+	for key, weight := range cfg.TenantWeights {
+		weights[auth.KeyID(key)] = weight
+	}
+	return scheduler{policy: cfg.SchedulerPolicy, weights: weights, limit: cfg.MaxJobsPerKey}
+}
+
+// lane resolves the priority and tenant a task is queued under
+func (s scheduler) lane(task *Task) {
+	if !ValidPriority(task.Priority) {
+		task.Priority = PriorityNormal
+	}
+	task.Tenant = task.KeyID
+	if task.Tenant == "" {
+		task.Tenant = "anonymous"
+	}
+	if s.policy == PolicyFIFO {
+		task.Priority = PriorityNormal
+		task.Tenant = fifoTenant
+	}
+}
@@ -0,0 +1,171 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// Recurring job definitions are kept in the hash schedules (ID -> JSON), with
+// the next fire time of every enabled one in the sorted set schedules:next.
+// schedule:<id>:runs lists the batch jobs created by past runs, oldest first.
+const (
+	schedulesKey      = "schedules"
+	scheduleNextKey   = "schedules:next"
+	scheduleLeaderKey = "schedules:leader"
+	maxScheduleRuns   = 100
+)
+
+func scheduleRunsKey(scheduleID string) string {
+	return fmt.Sprintf("schedule:%s:runs", scheduleID)
+}
+
+// Schedule is a recurring job definition: on every tick of Cron, each image
+// under SourcePrefix is run through Operations and written below OutputPrefix
+type Schedule struct {
+	ID           string      `json:"schedule_id"`
+	Name         string      `json:"name,omitempty"`
+	Cron         string      `json:"cron"`
+	SourcePrefix string      `json:"source_prefix"`
+	OutputPrefix string      `json:"output_prefix"`
+	Operations   []Operation `json:"operations"`
+	Priority     string      `json:"priority"`
+	KeyID        string      `json:"api_key_id,omitempty"`
+	Enabled      bool        `json:"enabled"`
+	CreatedAt    time.Time   `json:"created_at"`
+	NextRunAt    *time.Time  `json:"next_run_at,omitempty"`
+	LastRunAt    *time.Time  `json:"last_run_at,omitempty"`
+	LastJobID    string      `json:"last_job_id,omitempty"`
+}
+
+// SaveSchedule creates or replaces a schedule definition
+func (jm *Manager) SaveSchedule(ctx context.Context, s *Schedule) error {
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule: %w", err)
+	}
+	err = jm.store.HashSet(ctx, schedulesKey, s.ID, string(encoded))
+	if err == nil && s.Enabled && s.NextRunAt != nil {
+		err = jm.store.AddScored(ctx, scheduleNextKey, s.ID, float64(s.NextRunAt.UnixMilli()), false)
+	} else if err == nil {
+		_, err = jm.store.RemoveScored(ctx, scheduleNextKey, s.ID)
+	}
+	if err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to save schedule %s: %v", s.ID, err)
+		return err
+	}
+	return nil
+}
+
+// GetSchedule loads a schedule definition
+func (jm *Manager) GetSchedule(ctx context.Context, scheduleID string) (*Schedule, error) {
+	raw, ok, err := jm.store.HashGet(ctx, schedulesKey, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+	var s Schedule
+	if err := json.Unmarshal([]byte(raw), &s); err != nil {
+		return nil, fmt.Errorf("failed to decode schedule %s: %w", scheduleID, err)
+	}
+	return &s, nil
+}
+
+// ListSchedules returns every schedule in creation order
+func (jm *Manager) ListSchedules(ctx context.Context) ([]*Schedule, error) {
+	all, err := jm.store.HashGetAll(ctx, schedulesKey)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*Schedule, 0, len(all))
+	for id, raw := range all {
+		var s Schedule
+		if err := json.Unmarshal([]byte(raw), &s); err != nil {
+			log.Printf("[WARN] [Jobs] Skipping unreadable schedule %s: %v", id, err)
+			continue
+		}
+		list = append(list, &s)
+	}
+	// IDs are UUIDv7, so they sort by creation time
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// DeleteSchedule removes a schedule and its run history; jobs already created are kept
+func (jm *Manager) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	removed, err := jm.store.HashDelete(ctx, schedulesKey, scheduleID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrScheduleNotFound
+	}
+	if _, err := jm.store.RemoveScored(ctx, scheduleNextKey, scheduleID); err != nil {
+		return err
+	}
+	if err := jm.store.Delete(ctx, scheduleRunsKey(scheduleID)); err != nil {
+		return err
+	}
+	log.Printf("[INFO] [Jobs] Deleted schedule %s", scheduleID)
+	return nil
+}
+
+// DueSchedules returns the IDs of enabled schedules whose next run is at or before now
+func (jm *Manager) DueSchedules(ctx context.Context, now time.Time) ([]string, error) {
+	return jm.store.RangeScored(ctx, scheduleNextKey, float64(now.UnixMilli()))
+}
+
+// RecordScheduleRun stores the batch job created by a run in the schedule's history
+func (jm *Manager) RecordScheduleRun(ctx context.Context, scheduleID, batchID string, at time.Time) error {
+	// Re-read so a definition edited during the run is not overwritten
+	s, err := jm.GetSchedule(ctx, scheduleID)
+	if err != nil {
+		return err
+	}
+	at = at.UTC()
+	s.LastRunAt = &at
+	s.LastJobID = batchID
+	if err := jm.SaveSchedule(ctx, s); err != nil {
+		return err
+	}
+	return jm.store.PushList(ctx, scheduleRunsKey(scheduleID), batchID, maxScheduleRuns, 0)
+}
+
+// ScheduleRuns returns the batch jobs of a schedule's past runs, newest first.
+// Runs whose job record has expired are left out.
+func (jm *Manager) ScheduleRuns(ctx context.Context, scheduleID string) ([]*Job, error) {
+	ids, err := jm.store.ListRange(ctx, scheduleRunsKey(scheduleID), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	loaded, _, err := jm.loadJobs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]*Job, 0, len(loaded))
+	for i := len(loaded) - 1; i >= 0; i-- {
+		if loaded[i] != nil {
+			runs = append(runs, loaded[i])
+		}
+	}
+	return runs, nil
+}
+
+// AcquireScheduleLeadership makes owner the replica that fires schedules for
+// the next ttl. It must be called again before ttl passes to stay leader.
+func (jm *Manager) AcquireScheduleLeadership(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	return jm.store.AcquireLock(ctx, scheduleLeaderKey, owner, ttl)
+}
+
+// ReleaseScheduleLeadership gives up the lock so another replica can take over at once
+func (jm *Manager) ReleaseScheduleLeadership(ctx context.Context, owner string) error {
+	return jm.store.ReleaseLock(ctx, scheduleLeaderKey, owner)
+}
@@ -0,0 +1,154 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"file-formatter-tools/internal/config"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// JobStore is the storage behind Manager. Every method is atomic on its own,
+// and Manager builds the job lifecycle on top of them. RedisStore shares state
+// between replicas; MemoryStore keeps it inside one process, for single-binary
+// installs and for tests.
+//
+// Keys, members and lex bounds follow Redis conventions in both stores, so
+// the key helpers in this package (jobKey, statusIndex, ...) apply to either.
+type JobStore interface {
+	// CreateJob writes a new job record with a TTL and adds its ID to the given indexes
+	CreateJob(ctx context.Context, jobID string, fields map[string]interface{}, ttl time.Duration, indexes []string) error
+	// GetJobs returns the fields of each job record; a missing one is an empty map
+	GetJobs(ctx context.Context, jobIDs []string) ([]map[string]string, error)
+	// UpdateJob applies fields to a job that exists and is not in a terminal
+	// state (ErrJobNotFound, ErrJobFinished otherwise). A status change moves
+	// the job between status indexes, and the TTL is only ever raised to ttl.
+	UpdateJob(ctx context.Context, jobID string, fields map[string]interface{}, ttl time.Duration) error
+	// SetJobFields writes fields regardless of the job's state; a ttl > 0 raises the TTL to ttl
+	SetJobFields(ctx context.Context, jobID string, fields map[string]interface{}, ttl time.Duration) error
+
+	// RangeIndex returns up to count job IDs present in all of the indexes,
+	// between the lex bounds lower and upper ("-", "+", "[id" or "(id")
+	RangeIndex(ctx context.Context, indexes []string, lower, upper string, count int, desc bool) ([]string, error)
+	RemoveFromIndexes(ctx context.Context, indexes []string, jobIDs []string) error
+	// TrimIndexes removes the IDs lexically before `before` whose job record
+	// no longer exists from every index whose key starts with prefix, and
+	// returns how many were removed
+	TrimIndexes(ctx context.Context, prefix, before string) (int64, error)
+
+	// Publish notifies subscribers that a job changed. Subscribe returns a
+	// channel that receives a value per change, and a function to unsubscribe.
+	Publish(ctx context.Context, jobID string) error
+	Subscribe(ctx context.Context, jobID string) (<-chan struct{}, func(), error)
+
+	// Push appends an encoded Task to the lane for its priority and tenant
+	Push(ctx context.Context, payload string) error
+	// PromoteDue pushes every delayed task due by now and returns them;
+	// scheduled jobs among them become queued
+	PromoteDue(ctx context.Context, now time.Time) ([]string, error)
+	// Pop takes the next task under the weighted round-robin and leases it
+	// until leaseUntil, passing over API keys already running limit jobs
+	// (0 = no limit). Returns "" when nothing can run.
+	Pop(ctx context.Context, weights map[string]int, limit int, leaseUntil time.Time) (string, error)
+	// WaitForWork blocks until a task may be available or timeout passes
+	WaitForWork(ctx context.Context, timeout time.Duration) error
+	RenewLease(ctx context.Context, jobID string, until time.Time) (bool, error)
+	ReleaseLease(ctx context.Context, jobID string) error
+	// ExpireLeases releases up to limit leases that ended before now and returns their tasks
+	ExpireLeases(ctx context.Context, now time.Time, limit int) ([]string, error)
+
+	// Sorted sets of members due at a score (a timestamp)
+	AddScored(ctx context.Context, key, member string, score float64, onlyRaise bool) error
+	PopScored(ctx context.Context, key string, max float64, limit int) ([]string, error)
+	// MoveScored moves up to limit members scored at most max from one set
+	// to another, rescored to score, and returns them
+	MoveScored(ctx context.Context, from, to string, max, score float64, limit int) ([]string, error)
+	RangeScored(ctx context.Context, key string, max float64) ([]string, error)
+	RemoveScored(ctx context.Context, key, member string) (bool, error)
+
+	// PushList appends to a list, keeping at most maxLen (0 = all) newest entries
+	PushList(ctx context.Context, key, value string, maxLen int64, ttl time.Duration) error
+	// ListRange returns entries start..stop inclusive; negative indexes count from the end
+	ListRange(ctx context.Context, key string, start, stop int64) ([]string, error)
+
+	// AppendStream adds an entry to a stream, keeping at least the maxLen
+	// newest entries, and returns its ID
+	AppendStream(ctx context.Context, key string, values map[string]string, maxLen int64, ttl time.Duration) (string, error)
+	// ReadStream returns up to count entries with an ID after the given one
+	// ("" reads from the start), oldest first
+	ReadStream(ctx context.Context, key, after string, count int64) ([]StreamEntry, error)
+
+	HashSet(ctx context.Context, key, field, value string) error
+	HashGet(ctx context.Context, key, field string) (string, bool, error)
+	HashGetAll(ctx context.Context, key string) (map[string]string, error)
+	HashDelete(ctx context.Context, key, field string) (bool, error)
+	// HashIncr adds delta to a numeric field and returns the new value
+	HashIncr(ctx context.Context, key, field string, delta int64) (int64, error)
+
+	// SetIfAbsent stores value unless key exists; it returns the existing value and false then
+	SetIfAbsent(ctx context.Context, key, value string, ttl time.Duration) (string, bool, error)
+	Get(ctx context.Context, key string) (string, bool, error)
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	Expire(ctx context.Context, key string, ttl time.Duration, onlyRaise bool) error
+	Delete(ctx context.Context, keys ...string) error
+
+	// AcquireLock takes or renews the lock for owner; ReleaseLock drops it if owner holds it
+	AcquireLock(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+	ReleaseLock(ctx context.Context, key, owner string) error
+
+	Close() error
+}
+
+// StreamEntry is an entry of an append-only stream. IDs have the Redis form
+// "<milliseconds>-<sequence>" and increase with every entry.
+type StreamEntry struct {
+	ID     string
+	Values map[string]string
+}
+
+// nextStreamID returns the smallest stream ID after id, so a range can start
+// past an entry without the exclusive syntax of newer Redis versions
+func nextStreamID(id string) (string, error) {
+	ms, seq, err := parseStreamID(id)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%d", ms, seq+1), nil
+}
+
+func parseStreamID(id string) (ms, seq uint64, err error) {
+	rawMs, rawSeq, _ := strings.Cut(id, "-")
+	if ms, err = strconv.ParseUint(rawMs, 10, 64); err == nil && rawSeq != "" {
+		seq, err = strconv.ParseUint(rawSeq, 10, 64)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid stream ID %q", id)
+	}
+	return ms, seq, nil
+}
+
+// Store backends
+const (
+	StoreRedis  = "redis"
+	StoreMemory = "memory"
+)
+
+// NewStore returns the store selected by JOB_STORE
+func NewStore(cfg *config.Config) (JobStore, error) {
+	switch cfg.JobStore {
+	case StoreRedis, "":
+		rdb := redis.NewClient(&redis.Options{
+			Addr:     cfg.RedisAddr,
+			Password: "",
+			DB:       0,
+		})
+		return NewRedisStore(rdb), nil
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	}
+	return nil, fmt.Errorf("unknown job store %q, expected %s or %s", cfg.JobStore, StoreRedis, StoreMemory)
+}
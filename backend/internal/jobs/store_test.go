@@ -0,0 +1,473 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// Both stores must pass the same suite: Manager relies on them behaving alike
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, func(t *testing.T) JobStore { return NewMemoryStore() })
+}
+
+func TestRedisStore(t *testing.T) {
+	testStore(t, func(t *testing.T) JobStore { return newTestRedisStore(t) })
+}
+
+func newTestRedisStore(t *testing.T) *RedisStore {
+	t.Helper()
+	server := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func testStore(t *testing.T, newStore func(t *testing.T) JobStore) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s JobStore)
+	}{
+		{"Jobs", testStoreJobs},
+		{"Indexes", testStoreIndexes},
+		{"TrimIndexes", testStoreTrimIndexes},
+		{"PubSub", testStorePubSub},
+		{"Queue", testStoreQueue},
+		{"Leases", testStoreLeases},
+		{"Scored", testStoreScored},
+		{"Lists", testStoreLists},
+		{"Streams", testStoreStreams},
+		{"Hashes", testStoreHashes},
+		{"Strings", testStoreStrings},
+		{"Locks", testStoreLocks},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStore(t))
+		})
+	}
+}
+
+func testStoreJobs(t *testing.T, s JobStore) {
+	ctx := context.Background()
+	queued := statusIndex(StatusQueued)
+	fields := map[string]interface{}{"status": string(StatusQueued), "progress": 0}
+	if err := s.CreateJob(ctx, "job-1", fields, time.Hour, []string{indexAll, queued}); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+
+	records, err := s.GetJobs(ctx, []string{"job-1", "missing"})
+	if err != nil {
+		t.Fatalf("GetJobs: %v", err)
+	}
+	if got := records[0]; got["status"] != "queued" || got["progress"] != "0" {
+		t.Errorf("GetJobs record = %v", got)
+	}
+	if len(records[1]) != 0 {
+		t.Errorf("missing job record = %v, want empty", records[1])
+	}
+
+	// A status change moves the job between status indexes
+	running := statusIndex(StatusRunning)
+	if err := s.UpdateJob(ctx, "job-1", map[string]interface{}{"status": string(StatusRunning)}, time.Hour); err != nil {
+		t.Fatalf("UpdateJob: %v", err)
+	}
+	assertRange(t, s, []string{queued}, nil)
+	assertRange(t, s, []string{running}, []string{"job-1"})
+
+	if err := s.UpdateJob(ctx, "job-1", map[string]interface{}{"status": string(StatusSucceeded)}, time.Hour); err != nil {
+		t.Fatalf("UpdateJob: %v", err)
+	}
+	err = s.UpdateJob(ctx, "job-1", map[string]interface{}{"progress": 50}, time.Hour)
+	if !errors.Is(err, ErrJobFinished) {
+		t.Errorf("UpdateJob on a finished job = %v, want ErrJobFinished", err)
+	}
+	err = s.UpdateJob(ctx, "missing", map[string]interface{}{"progress": 50}, time.Hour)
+	if !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("UpdateJob on a missing job = %v, want ErrJobNotFound", err)
+	}
+
+	// SetJobFields ignores the state
+	if err := s.SetJobFields(ctx, "job-1", map[string]interface{}{"note": "kept"}, 0); err != nil {
+		t.Fatalf("SetJobFields: %v", err)
+	}
+	records, _ = s.GetJobs(ctx, []string{"job-1"})
+	if records[0]["note"] != "kept" || records[0]["status"] != "succeeded" {
+		t.Errorf("record after SetJobFields = %v", records[0])
+	}
+}
+
+func testStoreIndexes(t *testing.T, s JobStore) {
+	ctx := context.Background()
+	for _, id := range []string{"a", "b", "c", "d"} {
+		indexes := []string{indexAll}
+		if id != "b" {
+			indexes = append(indexes, keyIndex("k1"))
+		}
+		if err := s.CreateJob(ctx, id, map[string]interface{}{"status": "queued"}, time.Hour, indexes); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+	}
+
+	assertRange(t, s, []string{indexAll}, []string{"a", "b", "c", "d"})
+	assertRange(t, s, []string{indexAll, keyIndex("k1")}, []string{"a", "c", "d"})
+
+	got, err := s.RangeIndex(ctx, []string{indexAll}, "(a", "[c", 0, false)
+	if err != nil || !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Errorf("RangeIndex (a..[c = %v, %v", got, err)
+	}
+	got, err = s.RangeIndex(ctx, []string{indexAll}, "-", "+", 2, true)
+	if err != nil || !reflect.DeepEqual(got, []string{"d", "c"}) {
+		t.Errorf("RangeIndex desc with count = %v, %v", got, err)
+	}
+
+	if err := s.RemoveFromIndexes(ctx, []string{indexAll, keyIndex("k1")}, []string{"a", "c"}); err != nil {
+		t.Fatalf("RemoveFromIndexes: %v", err)
+	}
+	assertRange(t, s, []string{indexAll}, []string{"b", "d"})
+	assertRange(t, s, []string{keyIndex("k1")}, []string{"d"})
+}
+
+func testStoreTrimIndexes(t *testing.T, s JobStore) {
+	ctx := context.Background()
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if err := s.CreateJob(ctx, id, map[string]interface{}{"status": "queued"}, time.Hour, []string{indexAll, keyIndex("k1")}); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+	}
+	// Only IDs whose record is gone are trimmed
+	if err := s.Delete(ctx, jobKey("a"), jobKey("c"), jobKey("d")); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	// Sorted sets outside the prefix are left alone
+	if err := s.AddScored(ctx, "test:other", "a", 0, false); err != nil {
+		t.Fatalf("AddScored: %v", err)
+	}
+
+	removed, err := s.TrimIndexes(ctx, indexPrefix, "d")
+	if err != nil || removed != 4 {
+		t.Errorf("TrimIndexes = %d, %v, want 4 removed", removed, err)
+	}
+	assertRange(t, s, []string{indexAll}, []string{"b", "d"})
+	assertRange(t, s, []string{keyIndex("k1")}, []string{"b", "d"})
+	if got, _ := s.RangeScored(ctx, "test:other", 0); len(got) != 1 {
+		t.Errorf("set outside the prefix = %v, want it untouched", got)
+	}
+}
+
+func testStorePubSub(t *testing.T, s JobStore) {
+	ctx := context.Background()
+	ch, unsubscribe, err := s.Subscribe(ctx, "job-1")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer unsubscribe()
+
+	if err := s.Publish(ctx, "job-1"); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	select {
+	case <-ch:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no notification after Publish")
+	}
+}
+
+func testStoreQueue(t *testing.T, s JobStore) {
+	ctx := context.Background()
+	push := func(jobID, priority, tenant string) {
+		t.Helper()
+		if err := s.Push(ctx, encodeTestTask(jobID, priority, tenant)); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+	}
+	push("a1", PriorityNormal, "a")
+	push("a2", PriorityNormal, "a")
+	push("b1", PriorityNormal, "b")
+	push("h1", PriorityHigh, "a")
+
+	// High priority first, then tenants take turns
+	var order []string
+	for {
+		payload, err := s.Pop(ctx, nil, 0, time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatalf("Pop: %v", err)
+		}
+		if payload == "" {
+			break
+		}
+		order = append(order, decodeTestTask(t, payload).JobID)
+	}
+	if want := []string{"h1", "a1", "b1", "a2"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Pop order = %v, want %v", order, want)
+	}
+
+	// A delayed task is pushed once it is due, and its scheduled job becomes queued
+	if err := s.CreateJob(ctx, "later", map[string]interface{}{"status": string(StatusScheduled)}, time.Hour, []string{statusIndex(StatusScheduled)}); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	due := time.Now().Add(time.Minute)
+	if err := s.AddScored(ctx, delayedKey, encodeTestTask("later", PriorityNormal, "a"), float64(due.UnixMilli()), false); err != nil {
+		t.Fatalf("AddScored: %v", err)
+	}
+	if promoted, err := s.PromoteDue(ctx, time.Now()); err != nil || len(promoted) != 0 {
+		t.Errorf("PromoteDue before due = %v, %v", promoted, err)
+	}
+	if promoted, err := s.PromoteDue(ctx, due); err != nil || len(promoted) != 1 {
+		t.Fatalf("PromoteDue when due = %v, %v", promoted, err)
+	}
+	records, _ := s.GetJobs(ctx, []string{"later"})
+	if records[0]["status"] != string(StatusQueued) {
+		t.Errorf("promoted job status = %q, want queued", records[0]["status"])
+	}
+	assertRange(t, s, []string{statusIndex(StatusQueued)}, []string{"later"})
+	payload, err := s.Pop(ctx, nil, 0, time.Now().Add(time.Minute))
+	if err != nil || payload == "" || decodeTestTask(t, payload).JobID != "later" {
+		t.Errorf("Pop after PromoteDue = %q, %v", payload, err)
+	}
+}
+
+func testStoreLeases(t *testing.T, s JobStore) {
+	ctx := context.Background()
+	for _, id := range []string{"j1", "j2"} {
+		if err := s.Push(ctx, encodeTestTask(id, PriorityNormal, "a")); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+	}
+
+	// With a limit of one running job per API key, the second waits for the first lease
+	now := time.Now()
+	first, err := s.Pop(ctx, nil, 1, now.Add(time.Minute))
+	if err != nil || first == "" {
+		t.Fatalf("Pop = %q, %v", first, err)
+	}
+	if next, err := s.Pop(ctx, nil, 1, now.Add(time.Minute)); err != nil || next != "" {
+		t.Errorf("Pop past the limit = %q, %v, want nothing", next, err)
+	}
+	if err := s.ReleaseLease(ctx, "j1"); err != nil {
+		t.Fatalf("ReleaseLease: %v", err)
+	}
+	second, err := s.Pop(ctx, nil, 1, now.Add(time.Minute))
+	if err != nil || second == "" {
+		t.Fatalf("Pop after release = %q, %v", second, err)
+	}
+
+	if ok, err := s.RenewLease(ctx, "j2", now.Add(2*time.Minute)); err != nil || !ok {
+		t.Errorf("RenewLease = %v, %v", ok, err)
+	}
+	if ok, err := s.RenewLease(ctx, "j1", now.Add(2*time.Minute)); err != nil || ok {
+		t.Errorf("RenewLease of a released lease = %v, %v", ok, err)
+	}
+	if expired, err := s.ExpireLeases(ctx, now.Add(time.Minute), 10); err != nil || len(expired) != 0 {
+		t.Errorf("ExpireLeases before the renewed end = %v, %v", expired, err)
+	}
+	expired, err := s.ExpireLeases(ctx, now.Add(3*time.Minute), 10)
+	if err != nil || len(expired) != 1 || decodeTestTask(t, expired[0]).JobID != "j2" {
+		t.Errorf("ExpireLeases = %v, %v", expired, err)
+	}
+}
+
+func testStoreScored(t *testing.T, s JobStore) {
+	ctx := context.Background()
+	const key = "test:scored"
+	add := func(member string, score float64, onlyRaise bool) {
+		t.Helper()
+		if err := s.AddScored(ctx, key, member, score, onlyRaise); err != nil {
+			t.Fatalf("AddScored: %v", err)
+		}
+	}
+	add("a", 30, false)
+	add("b", 10, false)
+	add("c", 20, false)
+	add("b", 5, true) // not raised, kept at 10
+	add("c", 40, true)
+
+	got, err := s.RangeScored(ctx, key, 35)
+	if err != nil || !reflect.DeepEqual(got, []string{"b", "a"}) {
+		t.Errorf("RangeScored = %v, %v", got, err)
+	}
+	got, err = s.PopScored(ctx, key, 100, 2)
+	if err != nil || !reflect.DeepEqual(got, []string{"b", "a"}) {
+		t.Errorf("PopScored = %v, %v", got, err)
+	}
+	add("d", 50, false)
+	add("e", 60, false)
+	got, err = s.MoveScored(ctx, key, "test:moved", 100, 1, 1)
+	if err != nil || !reflect.DeepEqual(got, []string{"c"}) {
+		t.Errorf("MoveScored = %v, %v", got, err)
+	}
+	if got, _ := s.RangeScored(ctx, "test:moved", 1); !reflect.DeepEqual(got, []string{"c"}) {
+		t.Errorf("moved set = %v, want c at the new score", got)
+	}
+	if got, _ := s.RangeScored(ctx, key, 100); !reflect.DeepEqual(got, []string{"d", "e"}) {
+		t.Errorf("source set after MoveScored = %v", got)
+	}
+	if ok, err := s.RemoveScored(ctx, "test:moved", "c"); err != nil || !ok {
+		t.Errorf("RemoveScored = %v, %v", ok, err)
+	}
+	if ok, err := s.RemoveScored(ctx, key, "c"); err != nil || ok {
+		t.Errorf("RemoveScored twice = %v, %v", ok, err)
+	}
+}
+
+func testStoreLists(t *testing.T, s JobStore) {
+	ctx := context.Background()
+	const key = "test:list"
+	for _, v := range []string{"1", "2", "3", "4"} {
+		if err := s.PushList(ctx, key, v, 3, time.Hour); err != nil {
+			t.Fatalf("PushList: %v", err)
+		}
+	}
+	got, err := s.ListRange(ctx, key, 0, -1)
+	if err != nil || !reflect.DeepEqual(got, []string{"2", "3", "4"}) {
+		t.Errorf("ListRange = %v, %v", got, err)
+	}
+	got, err = s.ListRange(ctx, key, -2, -1)
+	if err != nil || !reflect.DeepEqual(got, []string{"3", "4"}) {
+		t.Errorf("ListRange of the last two = %v, %v", got, err)
+	}
+	got, err = s.ListRange(ctx, "test:missing", 0, -1)
+	if err != nil || len(got) != 0 {
+		t.Errorf("ListRange of a missing list = %v, %v", got, err)
+	}
+}
+
+func testStoreStreams(t *testing.T, s JobStore) {
+	ctx := context.Background()
+	const key = "test:stream"
+	var ids []string
+	for _, v := range []string{"1", "2", "3"} {
+		id, err := s.AppendStream(ctx, key, map[string]string{"v": v}, 0, time.Hour)
+		if err != nil {
+			t.Fatalf("AppendStream: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	entries, err := s.ReadStream(ctx, key, "", 0)
+	if err != nil || len(entries) != 3 || entries[0].Values["v"] != "1" {
+		t.Fatalf("ReadStream = %v, %v", entries, err)
+	}
+	entries, err = s.ReadStream(ctx, key, ids[0], 1)
+	if err != nil || len(entries) != 1 || entries[0].ID != ids[1] || entries[0].Values["v"] != "2" {
+		t.Errorf("ReadStream after the first entry = %v, %v", entries, err)
+	}
+	entries, err = s.ReadStream(ctx, key, ids[2], 0)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("ReadStream after the last entry = %v, %v", entries, err)
+	}
+}
+
+func testStoreHashes(t *testing.T, s JobStore) {
+	ctx := context.Background()
+	const key = "test:hash"
+	if err := s.HashSet(ctx, key, "f", "v"); err != nil {
+		t.Fatalf("HashSet: %v", err)
+	}
+	if v, ok, err := s.HashGet(ctx, key, "f"); err != nil || !ok || v != "v" {
+		t.Errorf("HashGet = %q, %v, %v", v, ok, err)
+	}
+	if _, ok, err := s.HashGet(ctx, key, "missing"); err != nil || ok {
+		t.Errorf("HashGet of a missing field = %v, %v", ok, err)
+	}
+	if n, err := s.HashIncr(ctx, key, "n", 2); err != nil || n != 2 {
+		t.Errorf("HashIncr = %d, %v", n, err)
+	}
+	if n, err := s.HashIncr(ctx, key, "n", -3); err != nil || n != -1 {
+		t.Errorf("HashIncr = %d, %v", n, err)
+	}
+	all, err := s.HashGetAll(ctx, key)
+	if err != nil || !reflect.DeepEqual(all, map[string]string{"f": "v", "n": "-1"}) {
+		t.Errorf("HashGetAll = %v, %v", all, err)
+	}
+	if ok, err := s.HashDelete(ctx, key, "f"); err != nil || !ok {
+		t.Errorf("HashDelete = %v, %v", ok, err)
+	}
+	if ok, err := s.HashDelete(ctx, key, "f"); err != nil || ok {
+		t.Errorf("HashDelete twice = %v, %v", ok, err)
+	}
+}
+
+func testStoreStrings(t *testing.T, s JobStore) {
+	ctx := context.Background()
+	if existing, ok, err := s.SetIfAbsent(ctx, "test:k", "first", time.Hour); err != nil || !ok || existing != "" {
+		t.Errorf("SetIfAbsent = %q, %v, %v", existing, ok, err)
+	}
+	if existing, ok, err := s.SetIfAbsent(ctx, "test:k", "second", time.Hour); err != nil || ok || existing != "first" {
+		t.Errorf("SetIfAbsent on an existing key = %q, %v, %v", existing, ok, err)
+	}
+	if err := s.Set(ctx, "test:k", "third", time.Hour); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if v, ok, err := s.Get(ctx, "test:k"); err != nil || !ok || v != "third" {
+		t.Errorf("Get = %q, %v, %v", v, ok, err)
+	}
+	if err := s.Delete(ctx, "test:k"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok, err := s.Get(ctx, "test:k"); err != nil || ok {
+		t.Errorf("Get after Delete = %v, %v", ok, err)
+	}
+}
+
+func testStoreLocks(t *testing.T, s JobStore) {
+	ctx := context.Background()
+	const key = "test:lock"
+	if ok, err := s.AcquireLock(ctx, key, "a", time.Minute); err != nil || !ok {
+		t.Errorf("AcquireLock = %v, %v", ok, err)
+	}
+	if ok, err := s.AcquireLock(ctx, key, "a", time.Minute); err != nil || !ok {
+		t.Errorf("AcquireLock renewal = %v, %v", ok, err)
+	}
+	if ok, err := s.AcquireLock(ctx, key, "b", time.Minute); err != nil || ok {
+		t.Errorf("AcquireLock held by another owner = %v, %v", ok, err)
+	}
+	// Only the owner can release
+	if err := s.ReleaseLock(ctx, key, "b"); err != nil {
+		t.Fatalf("ReleaseLock: %v", err)
+	}
+	if ok, _ := s.AcquireLock(ctx, key, "b", time.Minute); ok {
+		t.Error("lock released by a non-owner")
+	}
+	if err := s.ReleaseLock(ctx, key, "a"); err != nil {
+		t.Fatalf("ReleaseLock: %v", err)
+	}
+	if ok, err := s.AcquireLock(ctx, key, "b", time.Minute); err != nil || !ok {
+		t.Errorf("AcquireLock after release = %v, %v", ok, err)
+	}
+}
+
+func assertRange(t *testing.T, s JobStore, indexes []string, want []string) {
+	t.Helper()
+	got, err := s.RangeIndex(context.Background(), indexes, "-", "+", 0, false)
+	if err != nil {
+		t.Fatalf("RangeIndex: %v", err)
+	}
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RangeIndex %v = %v, want %v", indexes, got, want)
+	}
+}
+
+func encodeTestTask(jobID, priority, tenant string) string {
+	payload, _ := json.Marshal(Task{JobID: jobID, Type: "resize", KeyID: tenant, Priority: priority, Tenant: tenant})
+	return string(payload)
+}
+
+func decodeTestTask(t *testing.T, payload string) Task {
+	t.Helper()
+	var task Task
+	if err := json.Unmarshal([]byte(payload), &task); err != nil {
+		t.Fatalf("decode task: %v", err)
+	}
+	return task
+}
@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"context"
+	"log"
+)
+
+// publish notifies watchers that a job record changed
+func (jm *Manager) publish(ctx context.Context, jobID string) {
+	if err := jm.store.Publish(ctx, jobID); err != nil {
+		log.Printf("[WARN] [Jobs] Failed to publish update for job %s: %v", jobID, err)
+	}
+}
+
+// Watch streams snapshots of a job: the current state first, then one per change.
+// The channel is closed once the job reaches a terminal state or ctx is cancelled.
+func (jm *Manager) Watch(ctx context.Context, jobID string) (<-chan *Job, error) {
+	// Subscribe before reading the current state so no change is missed in between
+	notifications, unsubscribe, err := jm.store.Subscribe(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := jm.GetJob(ctx, jobID)
+	if err != nil {
+		unsubscribe()
+		return nil, err
+	}
+
+	updates := make(chan *Job)
+	go func() {
+		defer close(updates)
+		defer unsubscribe()
+
+		job := current
+		for {
+			select {
+			case updates <- job:
+			case <-ctx.Done():
+				return
+			}
+			if job.Status.IsTerminal() {
+				return
+			}
+
+			select {
+			case _, ok := <-notifications:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+
+			next, err := jm.GetJob(ctx, jobID)
+			if err != nil {
+				log.Printf("[ERROR] [Jobs] Failed to reload job %s while watching: %v", jobID, err)
+				return
+			}
+			job = next
+		}
+	}()
+	return updates, nil
+}
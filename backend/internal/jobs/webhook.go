@@ -0,0 +1,143 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// webhookPendingKey is a sorted set of deliveries scored by next attempt time;
+// webhookSendingKey holds claimed deliveries scored by the end of their lease
+const (
+	webhookPendingKey = "webhooks:pending"
+	webhookSendingKey = "webhooks:sending"
+)
+
+func webhookLogKey(jobID string) string {
+	return fmt.Sprintf("job:%s:webhooks", jobID)
+}
+
+// Delivery is a webhook notification for a job that reached a terminal state.
+// The payload is captured once so every retry sends (and signs) the same body.
+type Delivery struct {
+	ID      string `json:"id"`
+	JobID   string `json:"job_id"`
+	KeyID   string `json:"api_key_id"`
+	URL     string `json:"url"`
+	Event   string `json:"event"`
+	Payload string `json:"payload"`
+	Attempt int    `json:"attempt"`
+
+	claim string // the member in webhookSendingKey while leased
+}
+
+// DeliveryAttempt is one entry of a job's webhook delivery log
+type DeliveryAttempt struct {
+	DeliveryID string    `json:"delivery_id"`
+	Attempt    int       `json:"attempt"`
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	Delivered  bool      `json:"delivered"`
+}
+
+// enqueueWebhook schedules a delivery for a finished job that asked for a callback
+func (jm *Manager) enqueueWebhook(ctx context.Context, jobID string) {
+	job, err := jm.GetJob(ctx, jobID)
+	if err != nil || job.CallbackURL == "" {
+		return
+	}
+	payload, err := json.Marshal(job)
+	if err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to encode webhook payload for job %s: %v", jobID, err)
+		return
+	}
+	delivery := Delivery{
+		ID:      NewID(),
+		JobID:   jobID,
+		KeyID:   job.KeyID,
+		URL:     job.CallbackURL,
+		Event:   "job." + string(job.Status),
+		Payload: string(payload),
+	}
+	if err := jm.ScheduleDelivery(ctx, delivery, time.Now()); err != nil {
+		log.Printf("[ERROR] [Jobs] Failed to queue webhook for job %s: %v", jobID, err)
+	}
+}
+
+// ScheduleDelivery queues a webhook delivery attempt for the given time
+func (jm *Manager) ScheduleDelivery(ctx context.Context, delivery Delivery, at time.Time) error {
+	encoded, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to encode delivery: %w", err)
+	}
+	return jm.store.AddScored(ctx, webhookPendingKey, string(encoded), float64(at.UnixMilli()), false)
+}
+
+// DueDeliveries claims up to limit webhook deliveries whose attempt time has
+// come, leased for the given time. A delivery stays stored until
+// FinishDelivery; if its dispatcher dies first, the lease runs out and it is
+// sent again.
+func (jm *Manager) DueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]Delivery, error) {
+	now := time.Now()
+	expired, err := jm.store.MoveScored(ctx, webhookSendingKey, webhookPendingKey, float64(now.UnixMilli()), float64(now.UnixMilli()), limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(expired) > 0 {
+		log.Printf("[WARN] [Jobs] Re-queued %d webhook deliveries whose dispatcher stopped", len(expired))
+	}
+
+	raw, err := jm.store.MoveScored(ctx, webhookPendingKey, webhookSendingKey, float64(now.UnixMilli()), float64(now.Add(lease).UnixMilli()), limit)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]Delivery, 0, len(raw))
+	for _, item := range raw {
+		var d Delivery
+		if err := json.Unmarshal([]byte(item), &d); err != nil {
+			log.Printf("[WARN] [Jobs] Dropping malformed webhook delivery: %v", err)
+			_, _ = jm.store.RemoveScored(ctx, webhookSendingKey, item)
+			continue
+		}
+		d.claim = item
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+// FinishDelivery releases a claimed delivery once it was sent, failed for
+// good or was rescheduled
+func (jm *Manager) FinishDelivery(ctx context.Context, delivery Delivery) error {
+	_, err := jm.store.RemoveScored(ctx, webhookSendingKey, delivery.claim)
+	return err
+}
+
+// LogDelivery appends an attempt to the job's webhook delivery log
+func (jm *Manager) LogDelivery(ctx context.Context, jobID string, attempt DeliveryAttempt) error {
+	encoded, err := json.Marshal(attempt)
+	if err != nil {
+		return err
+	}
+	return jm.store.PushList(ctx, webhookLogKey(jobID), string(encoded), 0, jm.retention)
+}
+
+// DeliveryLog returns all webhook delivery attempts for a job, oldest first
+func (jm *Manager) DeliveryLog(ctx context.Context, jobID string) ([]DeliveryAttempt, error) {
+	raw, err := jm.store.ListRange(ctx, webhookLogKey(jobID), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	attempts := make([]DeliveryAttempt, 0, len(raw))
+	for _, item := range raw {
+		var a DeliveryAttempt
+		if err := json.Unmarshal([]byte(item), &a); err != nil {
+			continue
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, nil
+}
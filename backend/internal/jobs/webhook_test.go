@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"file-formatter-tools/internal/config"
+)
+
+func TestDeliveriesAreLeased(t *testing.T) {
+	ctx := context.Background()
+	jm := NewManager(NewMemoryStore(), &config.Config{})
+	if err := jm.ScheduleDelivery(ctx, Delivery{ID: "d1", JobID: "job-1"}, time.Now()); err != nil {
+		t.Fatalf("ScheduleDelivery: %v", err)
+	}
+
+	claimed, err := jm.DueDeliveries(ctx, 10, 20*time.Millisecond)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("DueDeliveries = %v, %v, want the delivery", claimed, err)
+	}
+	if again, _ := jm.DueDeliveries(ctx, 10, time.Minute); len(again) != 0 {
+		t.Errorf("leased delivery was claimed again: %v", again)
+	}
+
+	// The dispatcher stopped without finishing it: once the lease ends it is sent again
+	time.Sleep(30 * time.Millisecond)
+	claimed, err = jm.DueDeliveries(ctx, 10, time.Minute)
+	if err != nil || len(claimed) != 1 || claimed[0].ID != "d1" {
+		t.Fatalf("DueDeliveries after the lease = %v, %v, want the delivery back", claimed, err)
+	}
+
+	if err := jm.FinishDelivery(ctx, claimed[0]); err != nil {
+		t.Fatalf("FinishDelivery: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if left, _ := jm.DueDeliveries(ctx, 10, 0); len(left) != 0 {
+		t.Errorf("finished delivery came back: %v", left)
+	}
+}
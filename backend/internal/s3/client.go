@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"net/url"
 	"time"
@@ -93,4 +94,52 @@ func (c *Client) GetPresignedURL(ctx context.Context, objectName string, expiry
 	return u.String(), nil
 }
 
-// TODO: Implement delete methods as needed
+// Downloads an object from S3 and returns its contents
+func (c *Client) Download(ctx context.Context, objectName string) ([]byte, error) {
+	obj, err := c.Minio.GetObject(ctx, c.Bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		log.Printf("[ERROR] [S3] Failed to get object %s: %v", objectName, err)
+		return nil, err
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		log.Printf("[ERROR] [S3] Failed to read object %s: %v", objectName, err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// Lists the keys of all objects under a prefix
+func (c *Client) List(ctx context.Context, prefix string) ([]string, error) {
+	keys := []string{}
+	for obj := range c.Minio.ListObjects(ctx, c.Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			log.Printf("[ERROR] [S3] Failed to list objects under %s: %v", prefix, obj.Err)
+			return nil, obj.Err
+		}
+		keys = append(keys, obj.Key)
+	}
+	return keys, nil
+}
+
+// Deletes an object from S3
+func (c *Client) Delete(ctx context.Context, objectName string) error {
+	err := c.Minio.RemoveObject(ctx, c.Bucket, objectName, minio.RemoveObjectOptions{})
+	if err != nil {
+		log.Printf("[ERROR] [S3] Failed to delete object %s: %v", objectName, err)
+		return err
+	}
+	log.Printf("[INFO] [S3] Deleted object: %s", objectName)
+	return nil
+}
+
+// Reports whether an S3 error will not go away by retrying the request
+func IsPermanent(err error) bool {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchBucket", "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package schedules
+
+import (
+	"context"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"file-formatter-tools/internal/imgproc"
+	"file-formatter-tools/internal/jobs"
+	"file-formatter-tools/internal/s3"
+
+	"github.com/robfig/cron/v3"
+)
+
+// leaderTTL is how long the leader lock survives a replica that stopped renewing it
+const leaderTTL = 15 * time.Second
+
+// imageExtensions are the source objects a run picks up
+var imageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
+
+// Next returns the first time after t matched by a standard five-field cron
+// expression (or a descriptor such as "@daily"), evaluated in UTC
+func Next(expr string, t time.Time) (time.Time, error) {
+	sched, err := cron.ParseStandard(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return sched.Next(t.UTC()), nil
+}
+
+// Runner fires recurring schedules. Every replica runs one, but only the
+// holder of the Redis leader lock fires, so each run happens exactly once.
+type Runner struct {
+	jobManager *jobs.Manager
+	s3Client   *s3.Client
+	owner      string
+}
+
+func NewRunner(jobManager *jobs.Manager, s3Client *s3.Client) *Runner {
+	return &Runner{jobManager: jobManager, s3Client: s3Client, owner: jobs.NewID()}
+}
+
+// Run checks for due schedules every second until ctx is cancelled
+func (r *Runner) Run(ctx context.Context) {
+	log.Printf("[INFO] [Schedules] Runner started")
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	leader := false
+	for {
+		select {
+		case <-ctx.Done():
+			if leader {
+				_ = r.jobManager.ReleaseScheduleLeadership(context.WithoutCancel(ctx), r.owner)
+			}
+			log.Printf("[INFO] [Schedules] Runner stopped")
+			return
+		case <-ticker.C:
+			ok, err := r.jobManager.AcquireScheduleLeadership(ctx, r.owner, leaderTTL)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("[ERROR] [Schedules] Failed to acquire leadership: %v", err)
+				}
+				continue
+			}
+			if ok != leader {
+				log.Printf("[INFO] [Schedules] Leadership changed: leader=%t", ok)
+				leader = ok
+			}
+			if leader {
+				r.fireDue(context.WithoutCancel(ctx))
+			}
+		}
+	}
+}
+
+func (r *Runner) fireDue(ctx context.Context) {
+	now := time.Now()
+	due, err := r.jobManager.DueSchedules(ctx, now)
+	if err != nil {
+		log.Printf("[ERROR] [Schedules] Failed to load due schedules: %v", err)
+		return
+	}
+	for _, id := range due {
+		s, err := r.jobManager.GetSchedule(ctx, id)
+		if err != nil {
+			log.Printf("[ERROR] [Schedules] Failed to load schedule %s: %v", id, err)
+			continue
+		}
+
+		// Move on to the next tick before running, so a failing run is not retried in a loop
+		if next, err := Next(s.Cron, now); err != nil {
+			log.Printf("[ERROR] [Schedules] Disabling schedule %s with invalid cron %q: %v", id, s.Cron, err)
+			s.Enabled = false
+			s.NextRunAt = nil
+		} else {
+			s.NextRunAt = &next
+		}
+		if err := r.jobManager.SaveSchedule(ctx, s); err != nil {
+			continue
+		}
+		if !s.Enabled {
+			continue
+		}
+
+		batchID, err := r.fire(ctx, s)
+		if err != nil {
+			log.Printf("[ERROR] [Schedules] Run of schedule %s failed: %v", id, err)
+			continue
+		}
+		if err := r.jobManager.RecordScheduleRun(ctx, id, batchID, now); err != nil {
+			log.Printf("[ERROR] [Schedules] Failed to record run of schedule %s: %v", id, err)
+		}
+	}
+}
+
+// fire creates a batch job with one child per image under the source prefix
+func (r *Runner) fire(ctx context.Context, s *jobs.Schedule) (string, error) {
+	objects, err := r.s3Client.List(ctx, s.SourcePrefix)
+	if err != nil {
+		return "", err
+	}
+	sources := []string{}
+	for _, object := range objects {
+		if imageExtensions[strings.ToLower(path.Ext(object))] {
+			sources = append(sources, object)
+		}
+	}
+
+	batchID, err := r.jobManager.NewJob(ctx, jobs.Spec{Type: "batch", KeyID: s.KeyID, Priority: s.Priority, ScheduleID: s.ID})
+	if err != nil {
+		return "", err
+	}
+	log.Printf("[INFO] [Schedules] Running schedule %s: %d images under %s, batchJobID=%s", s.ID, len(sources), s.SourcePrefix, batchID)
+	if len(sources) == 0 {
+		return batchID, r.jobManager.SucceedJob(ctx, batchID, nil)
+	}
+	if err := r.jobManager.SetBatchSize(ctx, batchID, len(sources)); err != nil {
+		return "", err
+	}
+
+	final := s.Operations[len(s.Operations)-1].Options
+	created := 0
+	for _, source := range sources {
+		filename := path.Base(source)
+		jobID, err := r.jobManager.NewJob(ctx, jobs.Spec{
+			Type:     "resize",
+			ParentID: batchID,
+			KeyID:    s.KeyID,
+			Priority: s.Priority,
+			Filename: filename,
+			Options:  &final,
+		})
+		if err != nil {
+			log.Printf("[ERROR] [Schedules] Could not create job for %s: %v", source, err)
+			continue
+		}
+		created++
+
+		task := jobs.Task{
+			JobID:        jobID,
+			BatchID:      batchID,
+			Type:         "resize",
+			KeyID:        s.KeyID,
+			Priority:     s.Priority,
+			InputObject:  source,
+			Filename:     filename,
+			Pipeline:     s.Operations,
+			OutputObject: outputObject(s, source, final.OutputFormat),
+			KeepInput:    true,
+		}
+		if err := r.jobManager.Enqueue(ctx, task); err != nil {
+			_ = r.jobManager.FailJob(ctx, jobID, jobs.ErrCodeInternal, "Could not queue job")
+		}
+	}
+
+	// Children that could not be created will never finish, so don't wait for them
+	if created == 0 {
+		return batchID, r.jobManager.FailJob(ctx, batchID, jobs.ErrCodeInternal, "could not create any image job")
+	}
+	if created < len(sources) {
+		_ = r.jobManager.SetBatchSize(ctx, batchID, created)
+	}
+	_ = r.jobManager.RefreshBatch(ctx, batchID)
+	return batchID, nil
+}
+
+// outputObject mirrors a source object below the output prefix. A converted
+// image gets the extension of its new format.
+func outputObject(s *jobs.Schedule, source, format string) string {
+	name := path.Join(s.OutputPrefix, strings.TrimPrefix(source, s.SourcePrefix))
+	if format != "" {
+		name = strings.TrimSuffix(name, path.Ext(name)) + "." + imgproc.Extension(format)
+	}
+	return name
+}
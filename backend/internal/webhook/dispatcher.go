@@ -0,0 +1,205 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"file-formatter-tools/internal/auth"
+	"file-formatter-tools/internal/config"
+	"file-formatter-tools/internal/fetch"
+	"file-formatter-tools/internal/jobs"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// errNoSecret fails deliveries for API keys without a signing secret: they
+// are never sent unsigned
+var errNoSecret = errors.New("no webhook signing secret configured for this API key")
+
+// Dispatcher sends queued webhook deliveries and retries failed ones
+type Dispatcher struct {
+	jobManager *jobs.Manager
+	client     *http.Client
+	secrets    map[string]string // API key ID -> signing secret
+	retry      jobs.RetryPolicy
+	slots      chan struct{} // bounds the deliveries in flight
+	lease      time.Duration // how long a claimed delivery is ours
+}
+
+func NewDispatcher(jobManager *jobs.Manager, cfg *config.Config) *Dispatcher {
+	return &Dispatcher{
+		jobManager: jobManager,
+		client: &http.Client{
+			Timeout: cfg.WebhookTimeout,
+			// Receivers get the same address checks as fetched images
+			Transport: fetch.NewGuard(cfg).Transport(cfg.WebhookTimeout),
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse // a redirect is not an acknowledgement
+			},
+		},
+		secrets: secretsByKeyID(cfg),
+		retry: jobs.RetryPolicy{
+			MaxAttempts: cfg.WebhookMaxAttempts,
+			BaseDelay:   5 * time.Second,
+			MaxDelay:    5 * time.Minute,
+		},
+		slots: make(chan struct{}, max(1, cfg.WebhookConcurrency)),
+		// Covers the request plus logging the attempt
+		lease: cfg.WebhookTimeout + 30*time.Second,
+	}
+}
+
+func secretsByKeyID(cfg *config.Config) map[string]string {
+	secrets := make(map[string]string, len(cfg.WebhookSecrets))
+	for key, secret := range cfg.WebhookSecrets {
+		secrets[auth.KeyID(key)] = secret
+	}
+	return secrets
+}
+
+// ValidateCallback checks that a callback_url form value is usable: an
+// http(s) URL on an allowed address, for an API key with a signing secret
+func ValidateCallback(cfg *config.Config, keyID, raw string) error {
+	if err := fetch.NewGuard(cfg).CheckURL(raw); err != nil {
+		if errors.Is(err, fetch.ErrBlockedAddress) {
+			return fmt.Errorf("callback_url points to an address that is not allowed")
+		}
+		return fmt.Errorf("callback_url must be an absolute http(s) URL")
+	}
+	if _, ok := secretsByKeyID(cfg)[keyID]; !ok {
+		return errNoSecret
+	}
+	return nil
+}
+
+// Sign returns the signature header value for a payload sent at timestamp
+// (Unix seconds): "sha256=<hex HMAC of timestamp.body>". Receivers should
+// reject old timestamps so a captured delivery cannot be replayed.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run delivers webhooks until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	log.Printf("[INFO] [Webhook] Dispatcher started")
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var inFlight sync.WaitGroup
+	for {
+		select {
+		case <-ctx.Done():
+			inFlight.Wait()
+			log.Printf("[INFO] [Webhook] Dispatcher stopped")
+			return
+		case <-ticker.C:
+			// Only claim what can be sent now; the rest stays queued for other dispatchers
+			free := cap(d.slots) - len(d.slots)
+			if free == 0 {
+				continue
+			}
+			deliveries, err := d.jobManager.DueDeliveries(ctx, free, d.lease)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("[ERROR] [Webhook] Failed to load due deliveries: %v", err)
+				}
+				continue
+			}
+			for _, delivery := range deliveries {
+				d.slots <- struct{}{}
+				inFlight.Add(1)
+				go func() {
+					defer func() {
+						<-d.slots
+						inFlight.Done()
+					}()
+					d.deliver(context.WithoutCancel(ctx), delivery)
+				}()
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery jobs.Delivery) {
+	delivery.Attempt++
+	start := time.Now()
+	entry := jobs.DeliveryAttempt{DeliveryID: delivery.ID, Attempt: delivery.Attempt, At: start.UTC()}
+
+	status, err := d.send(ctx, delivery)
+	entry.DurationMS = time.Since(start).Milliseconds()
+	entry.StatusCode = status
+	if err == nil {
+		entry.Delivered = true
+		log.Printf("[INFO] [Webhook] Delivered %s for job %s to %s (status=%d)", delivery.Event, delivery.JobID, delivery.URL, status)
+	} else {
+		entry.Error = err.Error()
+		log.Printf("[WARN] [Webhook] Delivery %s for job %s failed (attempt %d/%d): %v", delivery.ID, delivery.JobID, delivery.Attempt, d.retry.MaxAttempts, err)
+	}
+	_ = d.jobManager.LogDelivery(ctx, delivery.JobID, entry)
+
+	if err != nil && delivery.Attempt < d.retry.MaxAttempts && !isPermanent(err) {
+		next := time.Now().Add(d.retry.Backoff(delivery.Attempt))
+		if err := d.jobManager.ScheduleDelivery(ctx, delivery, next); err != nil {
+			// Keep the claim: the delivery is retried once its lease runs out
+			log.Printf("[ERROR] [Webhook] Failed to reschedule delivery %s: %v", delivery.ID, err)
+			return
+		}
+	}
+	if err := d.jobManager.FinishDelivery(ctx, delivery); err != nil {
+		log.Printf("[ERROR] [Webhook] Failed to release delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// send POSTs the payload and treats any 2xx response as success
+func (d *Dispatcher) send(ctx context.Context, delivery jobs.Delivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	secret, ok := d.secrets[delivery.KeyID]
+	if !ok {
+		return 0, errNoSecret
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// isPermanent reports whether retrying a delivery cannot succeed
+func isPermanent(err error) bool {
+	return errors.Is(err, errNoSecret) || errors.Is(err, fetch.ErrBlockedAddress) || errors.Is(err, fetch.ErrInvalidURL)
+}
@@ -0,0 +1,160 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"time"
+
+	"file-formatter-tools/internal/imgproc"
+	"file-formatter-tools/internal/jobs"
+)
+
+// runPipeline runs the steps of a pipeline job, already in dependency order,
+// and uploads every named output. Progress is reported per step.
+func (p *Pool) runPipeline(ctx context.Context, task *jobs.Task) ([]jobs.Output, error) {
+	steps := jobs.PendingSteps(task.Pipeline)
+	if err := p.step(ctx, task.JobID, 10); err != nil {
+		p.releaseInput(ctx, task)
+		return nil, err
+	}
+
+	imageData, err := p.input(ctx, task)
+	if err != nil {
+		return nil, err
+	}
+	source, sourceFormat, err := imgproc.Decode(imageData)
+	if err != nil {
+		return nil, fail(jobs.ErrCodeInvalidInput, "failed to decode image", err)
+	}
+	// Steps work on the upright image; outputs carry no metadata
+	source = imgproc.Orient(source, imgproc.ReadMetadata(imageData, sourceFormat).Orientation)
+	if err := p.step(ctx, task.JobID, 20); err != nil {
+		p.releaseInput(ctx, task)
+		return nil, err
+	}
+
+	images := map[string]image.Image{jobs.SourceStep: source}
+	// Images are dropped once the last step reading them has run, so a long
+	// pipeline holds only the images still needed
+	readers := map[string]int{}
+	for _, op := range task.Pipeline {
+		readers[op.Input]++
+	}
+	outputs := []jobs.Output{}
+	// Outputs uploaded so far are removed again if a later step fails
+	abort := func(err error) ([]jobs.Output, error) {
+		for _, out := range outputs {
+			p.deleteOutput(ctx, task.JobID, out.ObjectName)
+		}
+		return nil, err
+	}
+
+	for i, op := range task.Pipeline {
+		steps[i].Status = jobs.StepRunning
+		_ = p.jobManager.SetSteps(ctx, task.JobID, steps)
+
+		img, err := applyStep(op, images[op.Input])
+		if err != nil {
+			steps[i].Status = jobs.StepFailed
+			_ = p.jobManager.SetSteps(ctx, task.JobID, steps)
+			return abort(fail(jobs.ErrCodeProcessing, "step "+op.ID+" failed", err))
+		}
+		if readers[op.Input]--; readers[op.Input] == 0 {
+			delete(images, op.Input)
+		}
+		if readers[op.ID] > 0 {
+			images[op.ID] = img
+		}
+
+		if op.Output != "" {
+			output, err := p.uploadStep(ctx, task, op, img, sourceFormat)
+			if err != nil {
+				steps[i].Status = jobs.StepFailed
+				_ = p.jobManager.SetSteps(ctx, task.JobID, steps)
+				return abort(err)
+			}
+			outputs = append(outputs, *output)
+		}
+
+		steps[i].Status = jobs.StepDone
+		_ = p.jobManager.SetSteps(ctx, task.JobID, steps)
+		if err := p.step(ctx, task.JobID, 20+70*(i+1)/len(task.Pipeline)); err != nil {
+			p.releaseInput(ctx, task)
+			return abort(err)
+		}
+	}
+
+	p.releaseInput(ctx, task)
+	return outputs, nil
+}
+
+func applyStep(op jobs.Operation, input image.Image) (image.Image, error) {
+	if input == nil {
+		return nil, fmt.Errorf("input %s is not available", op.Input)
+	}
+	switch op.Type {
+	case "resize":
+		return imgproc.Resize(input, op.Options.Spec()), nil
+	case "crop":
+		if op.Crop.Aspect != "" {
+			w, h, err := op.Crop.Ratio()
+			if err != nil {
+				return nil, err
+			}
+			return imgproc.CropToAspect(input, w, h), nil
+		}
+		rect := image.Rect(op.Crop.X, op.Crop.Y, op.Crop.X+op.Crop.Width, op.Crop.Y+op.Crop.Height)
+		if !rect.In(image.Rect(0, 0, input.Bounds().Dx(), input.Bounds().Dy())) {
+			return nil, fmt.Errorf("crop rectangle %v is outside the %dx%d image", rect, input.Bounds().Dx(), input.Bounds().Dy())
+		}
+		return imgproc.Crop(input, rect), nil
+	case "watermark":
+		return imgproc.Watermark(input, op.Watermark.Text, op.Watermark.Opacity), nil
+	case "encode":
+		return input, nil
+	}
+	return nil, fmt.Errorf("unsupported operation type %q", op.Type)
+}
+
+// uploadStep encodes the image of an output step and stores it next to the job's other outputs
+func (p *Pool) uploadStep(ctx context.Context, task *jobs.Task, op jobs.Operation, img image.Image, sourceFormat string) (*jobs.Output, error) {
+	format := op.Format
+	if format == "" {
+		format = sourceFormat
+	}
+	encoded, err := imgproc.Encode(img, format, op.Quality, 0)
+	if err != nil {
+		return nil, fail(jobs.ErrCodeProcessing, "failed to encode "+op.Output, err)
+	}
+	data := encoded.Data
+
+	objectName := fmt.Sprintf("pipeline/%s/%s.%s", task.JobID, op.Output, imgproc.Extension(format))
+	if err := p.s3Client.Upload(ctx, objectName, data, imgproc.ContentType(format)); err != nil {
+		return nil, fail(jobs.ErrCodeStorage, "failed to upload to S3", err)
+	}
+	_ = p.jobManager.ScheduleOutputDeletion(ctx, task.JobID, objectName, time.Now().Add(p.cfg.ResultRetention))
+	p.jobManager.RecordEvent(ctx, task.JobID, jobs.EventOutputUploaded, map[string]interface{}{
+		"name":   op.Output,
+		"object": objectName,
+		"format": format,
+		"bytes":  len(data),
+	})
+
+	url, err := p.s3Client.GetPresignedURL(ctx, objectName, p.cfg.PresignedURLExpiry)
+	if err != nil {
+		p.deleteOutput(ctx, task.JobID, objectName)
+		return nil, fail(jobs.ErrCodeStorage, "failed to get download URL", err)
+	}
+	expiresAt := time.Now().Add(p.cfg.PresignedURLExpiry)
+	return &jobs.Output{
+		Name:        op.Output,
+		ObjectName:  objectName,
+		DownloadURL: url,
+		Format:      format,
+		Width:       encoded.Width,
+		Height:      encoded.Height,
+		Quality:     encoded.Quality,
+		ExpiresAt:   &expiresAt,
+	}, nil
+}
@@ -0,0 +1,487 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"file-formatter-tools/internal/config"
+	"file-formatter-tools/internal/fetch"
+	"file-formatter-tools/internal/imgproc"
+	"file-formatter-tools/internal/jobs"
+	"file-formatter-tools/internal/s3"
+)
+
+// Pool runs a fixed number of workers pulling jobs from the Redis queue
+type Pool struct {
+	jobManager *jobs.Manager
+	s3Client   *s3.Client
+	fetcher    *fetch.Fetcher
+	cfg        *config.Config
+	size       int
+}
+
+func NewPool(jobManager *jobs.Manager, s3Client *s3.Client, cfg *config.Config) *Pool {
+	size := cfg.WorkerCount
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{jobManager: jobManager, s3Client: s3Client, fetcher: fetch.New(cfg), cfg: cfg, size: size}
+}
+
+// Run starts the workers and blocks until ctx is cancelled and all of them have stopped
+func (p *Pool) Run(ctx context.Context) {
+	log.Printf("[INFO] [Worker] Starting %d workers", p.size)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.promote(ctx)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.reap(ctx)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.recoverLeases(ctx)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.trimIndexes(ctx)
+	}()
+	for i := 0; i < p.size; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			p.loop(ctx, id)
+		}(i + 1)
+	}
+	wg.Wait()
+	log.Printf("[INFO] [Worker] All workers stopped")
+}
+
+// promote moves delayed jobs (retries and scheduled jobs) onto the work queue once they are due
+func (p *Pool) promote(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := p.jobManager.PromoteDue(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("[ERROR] [Worker] Failed to promote delayed jobs: %v", err)
+			} else if n > 0 {
+				log.Printf("[INFO] [Worker] Promoted %d delayed jobs", n)
+			}
+		}
+	}
+}
+
+// reap deletes S3 objects whose retention has ended
+func (p *Pool) reap(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			due, err := p.jobManager.DueDeletions(ctx, 100)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("[ERROR] [Worker] Failed to load expired objects: %v", err)
+				}
+				continue
+			}
+			for _, objectName := range due {
+				_ = p.s3Client.Delete(ctx, objectName)
+				p.jobManager.OutputExpired(ctx, objectName)
+			}
+			if len(due) > 0 {
+				log.Printf("[INFO] [Worker] Deleted %d expired objects", len(due))
+			}
+		}
+	}
+}
+
+// recoverLeases requeues jobs whose worker stopped renewing its lease, e.g.
+// because its replica crashed or was restarted mid-job
+func (p *Pool) recoverLeases(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.WorkerLeaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := p.jobManager.RecoverExpiredLeases(ctx, 100); err != nil && ctx.Err() == nil {
+				log.Printf("[ERROR] [Worker] Failed to recover expired leases: %v", err)
+			} else if n > 0 {
+				log.Printf("[WARN] [Worker] Requeued %d jobs with expired leases", n)
+			}
+		}
+	}
+}
+
+// trimIndexes drops the IDs of long-expired jobs from the job indexes
+func (p *Pool) trimIndexes(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := p.jobManager.TrimIndexes(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("[ERROR] [Worker] Failed to trim job indexes: %v", err)
+			} else if n > 0 {
+				log.Printf("[INFO] [Worker] Removed %d expired job IDs from indexes", n)
+			}
+		}
+	}
+}
+
+// heartbeat renews the lease on a job until the returned function is called,
+// which also releases the lease
+func (p *Pool) heartbeat(ctx context.Context, id int, jobID string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(p.cfg.WorkerLeaseTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				held, err := p.jobManager.RenewLease(ctx, jobID)
+				if err != nil {
+					log.Printf("[ERROR] [Worker %d] Failed to renew lease on job %s: %v", id, jobID, err)
+				} else if !held {
+					log.Printf("[WARN] [Worker %d] Lost lease on job %s, it may run twice", id, jobID)
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		_ = p.jobManager.ReleaseLease(ctx, jobID)
+	}
+}
+
+func (p *Pool) loop(ctx context.Context, id int) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		task, err := p.jobManager.Dequeue(ctx, 5*time.Second)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("[ERROR] [Worker %d] Failed to dequeue job: %v", id, err)
+			time.Sleep(time.Second)
+			continue
+		}
+		if task == nil {
+			continue
+		}
+		p.process(context.WithoutCancel(ctx), id, task)
+	}
+}
+
+// errCancelled is returned by a step boundary once the job has been cancelled
+var errCancelled = errors.New("job cancelled")
+
+// jobError carries the error code to store on a failed job and whether
+// another attempt could succeed
+type jobError struct {
+	code      string
+	retryable bool
+	err       error
+}
+
+func (e *jobError) Error() string { return e.err.Error() }
+func (e *jobError) Unwrap() error { return e.err }
+
+// fail wraps err with a job error code; storage and fetch errors are retried
+// unless S3 or the image server report a condition that will not go away on its own
+func fail(code, msg string, err error) error {
+	retryable := false
+	switch code {
+	case jobs.ErrCodeStorage:
+		retryable = !s3.IsPermanent(err)
+	case jobs.ErrCodeFetch:
+		retryable = !fetch.IsPermanent(err)
+	}
+	return &jobError{
+		code:      code,
+		retryable: retryable,
+		err:       fmt.Errorf("%s: %w", msg, err),
+	}
+}
+
+// process runs a single job to completion; it is not interrupted by shutdown
+func (p *Pool) process(ctx context.Context, id int, task *jobs.Task) {
+	start := time.Now()
+	defer p.heartbeat(ctx, id, task.JobID)()
+	task.Attempt++
+	if err := p.jobManager.StartJob(ctx, task.JobID, task.Attempt); err != nil {
+		p.notStarted(ctx, id, task, err)
+		return
+	}
+	log.Printf("[INFO] [Worker %d] Processing jobID=%s, file=%s, attempt=%d", id, task.JobID, task.Filename, task.Attempt)
+	if task.BatchID != "" {
+		_ = p.jobManager.RefreshBatch(ctx, task.BatchID)
+	}
+
+	outputs, err := p.run(ctx, task)
+	switch {
+	case errors.Is(err, errCancelled):
+		log.Printf("[INFO] [Worker %d] Job %s was cancelled", id, task.JobID)
+	case err != nil:
+		p.handleFailure(ctx, id, task, err)
+	default:
+		err := p.jobManager.SucceedJob(ctx, task.JobID, outputs)
+		switch {
+		case errors.Is(err, jobs.ErrJobFinished):
+			// Cancelled after the last step boundary
+			for _, output := range outputs {
+				p.deleteOutput(ctx, task.JobID, output.ObjectName)
+			}
+		case err == nil && task.CacheKey != "":
+			_ = p.jobManager.CacheResult(ctx, task.CacheKey, task.JobID, outputs[0])
+		}
+	}
+
+	if task.BatchID != "" {
+		_ = p.jobManager.RefreshBatch(ctx, task.BatchID)
+	}
+	log.Printf("[INFO] [Worker %d] Finished jobID=%s, duration=%s", id, task.JobID, time.Since(start))
+}
+
+// notStarted handles a task whose job could not be moved to running: it was
+// cancelled, its record expired, or the store failed. Only the last case is
+// tried again, within the task's attempts.
+func (p *Pool) notStarted(ctx context.Context, id int, task *jobs.Task, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrJobFinished):
+		log.Printf("[INFO] [Worker %d] Skipping cancelled jobID=%s", id, task.JobID)
+	case errors.Is(err, jobs.ErrJobNotFound):
+		log.Printf("[WARN] [Worker %d] Skipping expired jobID=%s", id, task.JobID)
+	default:
+		if task.Attempt < task.Retry.MaxAttempts {
+			retryAt := time.Now().Add(task.Retry.Backoff(task.Attempt))
+			if qerr := p.jobManager.EnqueueAt(ctx, *task, retryAt); qerr == nil {
+				log.Printf("[WARN] [Worker %d] Could not start job %s, retrying at %s: %v", id, task.JobID, retryAt.Format(time.RFC3339), err)
+				return
+			}
+		}
+		log.Printf("[ERROR] [Worker %d] Could not start job %s, giving up: %v", id, task.JobID, err)
+		_ = p.jobManager.FailJob(ctx, task.JobID, jobs.ErrCodeInternal, err.Error())
+		if task.BatchID != "" {
+			_ = p.jobManager.RefreshBatch(ctx, task.BatchID)
+		}
+	}
+	p.releaseInput(ctx, task)
+}
+
+// handleFailure retries transient errors and fails the job otherwise
+func (p *Pool) handleFailure(ctx context.Context, id int, task *jobs.Task, err error) {
+	code := jobs.ErrCodeInternal
+	var jerr *jobError
+	if errors.As(err, &jerr) {
+		code = jerr.code
+	}
+
+	if jerr != nil && jerr.retryable {
+		retried, rerr := p.jobManager.RetryJob(ctx, *task, err)
+		if rerr != nil && !errors.Is(rerr, jobs.ErrJobFinished) {
+			log.Printf("[ERROR] [Worker %d] Could not schedule retry for job %s: %v", id, task.JobID, rerr)
+		}
+		if retried || errors.Is(rerr, jobs.ErrJobFinished) {
+			return
+		}
+		if rerr == nil {
+			// Out of attempts, keep it around for inspection
+			_ = p.jobManager.AddDeadLetter(ctx, *task, err)
+		}
+	}
+
+	log.Printf("[ERROR] [Worker %d] Job %s failed: %v", id, task.JobID, err)
+	_ = p.jobManager.FailJob(ctx, task.JobID, code, err.Error())
+}
+
+// step records progress and reports errCancelled if the job was cancelled meanwhile
+func (p *Pool) step(ctx context.Context, jobID string, progress int) error {
+	if err := p.jobManager.SetProgress(ctx, jobID, progress); errors.Is(err, jobs.ErrJobFinished) {
+		return errCancelled
+	}
+	return nil
+}
+
+// run processes a task according to its job type
+func (p *Pool) run(ctx context.Context, task *jobs.Task) ([]jobs.Output, error) {
+	if task.Type == "pipeline" {
+		return p.runPipeline(ctx, task)
+	}
+	output, err := p.resize(ctx, task)
+	if err != nil {
+		return nil, err
+	}
+	return []jobs.Output{*output}, nil
+}
+
+func (p *Pool) resize(ctx context.Context, task *jobs.Task) (*jobs.Output, error) {
+	if err := p.step(ctx, task.JobID, 10); err != nil {
+		p.releaseInput(ctx, task)
+		return nil, err
+	}
+
+	imageData, err := p.input(ctx, task)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.step(ctx, task.JobID, 30); err != nil {
+		p.releaseInput(ctx, task)
+		return nil, err
+	}
+
+	img, format, err := imgproc.Decode(imageData)
+	if err != nil {
+		return nil, fail(jobs.ErrCodeInvalidInput, "failed to decode image", err)
+	}
+	// Orientation, metadata and encoding follow the options of the last step
+	ops := pipeline(task)
+	opts := ops[len(ops)-1].Options
+	metadata := imgproc.ReadMetadata(imageData, format)
+	if !opts.IgnoreOrientation {
+		img = imgproc.Orient(img, metadata.Orientation)
+	}
+	for _, op := range ops {
+		if img, err = applyStep(op, img); err != nil {
+			return nil, fail(jobs.ErrCodeProcessing, "resize failed", err)
+		}
+	}
+	if opts.OutputFormat != "" {
+		format = opts.OutputFormat
+	}
+	encoded, err := imgproc.Encode(img, format, opts.Quality, opts.MaxSizeKB)
+	if errors.Is(err, imgproc.ErrSizeLimit) {
+		return nil, fail(jobs.ErrCodeProcessing, fmt.Sprintf("image does not fit into %d KB even at %dx%d", opts.MaxSizeKB, encoded.Width, encoded.Height), err)
+	}
+	if err != nil {
+		return nil, fail(jobs.ErrCodeProcessing, "resize failed", err)
+	}
+	if encoded.Width != img.Bounds().Dx() || encoded.Palette {
+		log.Printf("[INFO] [Worker] Job %s reduced to %dx%d (quality=%d, palette=%t) to fit %d KB", task.JobID, encoded.Width, encoded.Height, encoded.Quality, encoded.Palette, opts.MaxSizeKB)
+	}
+	output, err := imgproc.EmbedEXIF(encoded.Data, format, metadata.EXIF(opts.Metadata, !opts.IgnoreOrientation))
+	if err != nil {
+		return nil, fail(jobs.ErrCodeProcessing, "failed to write metadata", err)
+	}
+	if err := p.step(ctx, task.JobID, 60); err != nil {
+		p.releaseInput(ctx, task)
+		return nil, err
+	}
+
+	// The object is named after the format it was written in, not the upload
+	ext := imgproc.Extension(format)
+
+	// Job IDs are unique, so retries overwrite their own output rather than another job's
+	objectName := fmt.Sprintf("resize/%s.%s", task.JobID, ext)
+	if task.BatchID != "" {
+		objectName = fmt.Sprintf("batch/%s/%s.%s", task.BatchID, task.JobID, ext)
+	}
+	if task.OutputObject != "" {
+		objectName = task.OutputObject
+	}
+
+	if err := p.s3Client.Upload(ctx, objectName, output, imgproc.ContentType(format)); err != nil {
+		return nil, fail(jobs.ErrCodeStorage, "failed to upload to S3", err)
+	}
+
+	// The uploaded input is no longer needed once the output is stored
+	p.releaseInput(ctx, task)
+	if task.OutputObject == "" {
+		_ = p.jobManager.ScheduleOutputDeletion(ctx, task.JobID, objectName, time.Now().Add(p.cfg.ResultRetention))
+	}
+	p.jobManager.RecordEvent(ctx, task.JobID, jobs.EventOutputUploaded, map[string]interface{}{
+		"object":  objectName,
+		"format":  format,
+		"bytes":   len(output),
+		"width":   encoded.Width,
+		"height":  encoded.Height,
+		"quality": encoded.Quality,
+	})
+
+	if err := p.step(ctx, task.JobID, 80); err != nil {
+		p.deleteOutput(ctx, task.JobID, objectName)
+		return nil, err
+	}
+
+	url, err := p.s3Client.GetPresignedURL(ctx, objectName, p.cfg.PresignedURLExpiry)
+	if err != nil {
+		return nil, fail(jobs.ErrCodeStorage, "failed to get download URL", err)
+	}
+	expiresAt := time.Now().Add(p.cfg.PresignedURLExpiry)
+
+	return &jobs.Output{
+		ObjectName:  objectName,
+		DownloadURL: url,
+		Format:      format,
+		Width:       encoded.Width,
+		Height:      encoded.Height,
+		Quality:     encoded.Quality,
+		ExpiresAt:   &expiresAt,
+	}, nil
+}
+
+// pipeline returns the steps to apply; a plain resize job is a single step.
+// Steps are resizes and crops, see applyStep.
+func pipeline(task *jobs.Task) []jobs.Operation {
+	if len(task.Pipeline) > 0 {
+		return task.Pipeline
+	}
+	return []jobs.Operation{{Type: "resize", Options: task.Options}}
+}
+
+// input reads the image of a task, fetched from its source URL or stored in S3
+func (p *Pool) input(ctx context.Context, task *jobs.Task) ([]byte, error) {
+	if task.SourceURL != "" {
+		data, _, err := p.fetcher.Fetch(ctx, task.SourceURL)
+		if err != nil {
+			return nil, fail(jobs.ErrCodeFetch, "failed to fetch image", err)
+		}
+		return data, nil
+	}
+	data, err := p.s3Client.Download(ctx, task.InputObject)
+	if err != nil {
+		return nil, fail(jobs.ErrCodeStorage, "failed to read image", err)
+	}
+	return data, nil
+}
+
+// deleteOutput removes an uploaded output of a job that did not succeed after all
+func (p *Pool) deleteOutput(ctx context.Context, jobID, objectName string) {
+	_ = p.s3Client.Delete(ctx, objectName)
+	p.jobManager.OutputDeleted(ctx, jobID, objectName)
+}
+
+// releaseInput deletes an uploaded input, but never a source object the job only reads
+func (p *Pool) releaseInput(ctx context.Context, task *jobs.Task) {
+	if !task.KeepInput && task.InputObject != "" {
+		_ = p.s3Client.Delete(ctx, task.InputObject)
+	}
+}
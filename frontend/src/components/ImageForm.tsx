@@ -1,5 +1,6 @@
 import { imageState } from '../hooks/useImageProcessor';
 import { fetchWithAuth } from '../utils/api';
+import { API_KEY } from '../config';
 
 export function ImageForm() {
   const handleSubmit = async (event: Event) => {
@@ -27,6 +28,10 @@ export function ImageForm() {
     formData.append('maintainAspectRatio', imageState.value.maintainAspectRatio.toString());
     formData.append('quality', imageState.value.quality.toString());
     if (imageState.value.maxSize) formData.append('maxSize', imageState.value.maxSize);
+    if (imageState.value.outputFormat) formData.append('output_format', imageState.value.outputFormat);
+    if (imageState.value.metadata) formData.append('metadata', imageState.value.metadata);
+    if (imageState.value.mode) formData.append('mode', imageState.value.mode);
+    if (imageState.value.filter) formData.append('filter', imageState.value.filter);
 
     try {
       const response = await fetchWithAuth('/api/resize', {
@@ -44,14 +49,13 @@ export function ImageForm() {
       // console.log('[DEBUG] Original URL:', data.download_url);
       // console.log('[DEBUG] Transformed URL:', transformedUrl);
 
+      // The job is queued; the download URL arrives with the progress updates
       imageState.value = {
         ...imageState.value,
-        jobId: data.job_id,
-        downloadUrl: data.download_url,
-        objectName: data.object_name
+        jobId: data.job_id
       };
 
-      pollProgress();
+      streamProgress();
     } catch (error) {
       if (error instanceof Error) {
         imageState.value = { ...imageState.value, errorMessage: error.message };
@@ -59,29 +63,46 @@ export function ImageForm() {
     }
   };
 
-  const pollProgress = () => {
-    const interval = setInterval(async () => {
-      try {
-        const response = await fetchWithAuth(`/api/progress/${imageState.value.jobId}`);
-        const data = await response.json();
-        console.log('[DEBUG] Progress data:', data);
+  const streamProgress = () => {
+    // EventSource cannot send headers, so the API key goes in the query string
+    const url = `/api/progress/${imageState.value.jobId}/stream?api_key=${encodeURIComponent(API_KEY)}`;
+    const source = new EventSource(url);
 
-        imageState.value = { ...imageState.value, progress: data.progress };
+    source.addEventListener('progress', (event) => {
+      const data = JSON.parse((event as MessageEvent).data);
+      imageState.value = {
+        ...imageState.value,
+        progress: data.progress,
+        downloadUrl: data.outputs?.[0]?.download_url ?? imageState.value.downloadUrl,
+        objectName: data.outputs?.[0]?.object_name ?? imageState.value.objectName
+      };
 
-        if (data.progress === 100) {
-          clearInterval(interval);
-          if (imageState.value.downloadUrl) {
-            updateProcessedImageData(imageState.value.downloadUrl);
-          }
+      if (data.status === 'failed' || data.status === 'cancelled') {
+        source.close();
+        imageState.value = { ...imageState.value, errorMessage: data.error || `Job ${data.status}` };
+        return;
+      }
+
+      if (data.status === 'succeeded') {
+        source.close();
+        if (imageState.value.downloadUrl) {
+          updateProcessedImageData(imageState.value.downloadUrl);
         }
-      } catch (error) {
-        clearInterval(interval);
-        imageState.value = {
-          ...imageState.value,
-          errorMessage: 'Failed to fetch progress. Please try again.'
-        };
       }
-    }, 2000);
+    });
+
+    source.onerror = () => {
+      // The server closes the stream after the final event; only report unexpected drops
+      if (imageState.value.progress === 100) {
+        source.close();
+        return;
+      }
+      source.close();
+      imageState.value = {
+        ...imageState.value,
+        errorMessage: 'Failed to fetch progress. Please try again.'
+      };
+    };
   };
 
   const updateProcessedImageData = async (downloadUrl: string) => {
@@ -155,6 +176,36 @@ export function ImageForm() {
         </label>
       </div>
 
+      {/* Resize Mode and Filter */}
+      <div class="flex flex-wrap items-center gap-2">
+        <label htmlFor="mode" class="font-medium text-gray-200 whitespace-nowrap">Mode:</label>
+        <select
+          id="mode"
+          class="px-2 py-1 rounded border border-gray-500 bg-gray-800 text-white"
+          value={imageState.value.mode}
+          onChange={e => imageState.value = { ...imageState.value, mode: e.currentTarget.value }}
+        >
+          <option value="">Default</option>
+          <option value="fit">Fit</option>
+          <option value="fill">Fill (crop)</option>
+          <option value="pad">Pad</option>
+          <option value="stretch">Stretch</option>
+        </select>
+        <label htmlFor="filter" class="font-medium text-gray-200 whitespace-nowrap">Filter:</label>
+        <select
+          id="filter"
+          class="px-2 py-1 rounded border border-gray-500 bg-gray-800 text-white"
+          value={imageState.value.filter}
+          onChange={e => imageState.value = { ...imageState.value, filter: e.currentTarget.value }}
+        >
+          <option value="">Lanczos</option>
+          <option value="catmull-rom">Catmull-Rom</option>
+          <option value="linear">Linear</option>
+          <option value="box">Box</option>
+          <option value="nearest">Nearest (pixel art)</option>
+        </select>
+      </div>
+
       {/* Quality and Max Size */}
       <div class="flex flex-wrap items-center gap-2">
         <label htmlFor="quality" class="font-medium text-gray-200 whitespace-nowrap">Quality (1-100):</label>
@@ -184,6 +235,38 @@ export function ImageForm() {
         />
         <span class="text-gray-400">kb</span>
       </div>
+
+      {/* Output Format */}
+      <div class="flex flex-wrap items-center gap-2">
+        <label htmlFor="outputFormat" class="font-medium text-gray-200 whitespace-nowrap">Format:</label>
+        <select
+          id="outputFormat"
+          class="px-2 py-1 rounded border border-gray-500 bg-gray-800 text-white"
+          value={imageState.value.outputFormat}
+          onChange={e => imageState.value = { ...imageState.value, outputFormat: e.currentTarget.value }}
+        >
+          <option value="">Same as input</option>
+          <option value="jpeg">JPEG</option>
+          <option value="png">PNG</option>
+          <option value="webp">WebP</option>
+          <option value="gif">GIF</option>
+        </select>
+      </div>
+
+      {/* Metadata */}
+      <div class="flex flex-wrap items-center gap-2">
+        <label htmlFor="metadata" class="font-medium text-gray-200 whitespace-nowrap">Metadata:</label>
+        <select
+          id="metadata"
+          class="px-2 py-1 rounded border border-gray-500 bg-gray-800 text-white"
+          value={imageState.value.metadata}
+          onChange={e => imageState.value = { ...imageState.value, metadata: e.currentTarget.value }}
+        >
+          <option value="">Strip all</option>
+          <option value="safe">Keep author, copyright and date</option>
+          <option value="preserve">Keep all except location</option>
+        </select>
+      </div>
       <button
         type="submit"
         disabled={
@@ -8,6 +8,10 @@ export const initialState: ImageState = {
   maintainAspectRatio: true,
   quality: 80,
   maxSize: '',
+  outputFormat: '',
+  metadata: '',
+  mode: '',
+  filter: '',
   jobId: null,
   progress: 0,
   downloadUrl: null,
@@ -5,6 +5,10 @@ export interface ImageState {
   maintainAspectRatio: boolean;
   quality: number;
   maxSize: string;
+  outputFormat: string;
+  metadata: string;
+  mode: string;
+  filter: string;
   jobId: string | null;
   progress: number;
   downloadUrl: string | null;